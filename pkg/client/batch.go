@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// PgBatch sends several commands to the server in a single write and reads
+// their results back in order
+type PgBatch struct {
+	connection *PgConnection
+	commands   []*PgCommand
+	// Transactional runs the batch as one implicit transaction: the first
+	// failing command rolls back the whole batch and the rest are skipped.
+	// Otherwise every command is synced and commits or fails on its own.
+	Transactional bool
+}
+
+// BatchResult is the outcome of one command in a batch
+type BatchResult struct {
+	Columns    []string
+	Rows       []map[string]any
+	CommandTag CommandTag
+	Err        error
+}
+
+var ErrBatchCommandSkipped = errors.New("command skipped because an earlier command in the batch failed")
+
+func NewPgBatch(conn *PgConnection) *PgBatch {
+	return &PgBatch{
+		connection: conn,
+		commands:   make([]*PgCommand, 0),
+	}
+}
+
+// Queue adds a command for the given text and returns it so parameters can be set
+func (batch *PgBatch) Queue(commandText string) *PgCommand {
+	cmd := NewPgCommand(commandText, batch.connection)
+	batch.commands = append(batch.commands, cmd)
+	return cmd
+}
+
+func (batch *PgBatch) Add(cmd *PgCommand) {
+	batch.commands = append(batch.commands, cmd)
+}
+
+func (batch *PgBatch) Len() int {
+	return len(batch.commands)
+}
+
+// Execute sends all queued commands and returns one result per command. The
+// returned error is the first command error, if any.
+func (batch *PgBatch) Execute() ([]BatchResult, error) {
+	if len(batch.commands) == 0 {
+		return []BatchResult{}, nil
+	}
+
+	req := QueryRequest{
+		kind:          requestBatch,
+		batch:         make([]QueryRequest, len(batch.commands)),
+		transactional: batch.Transactional,
+	}
+	for i, cmd := range batch.commands {
+		command, err := cmd.newRequest(nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("batch command %d: %w", i, err)
+		}
+		req.batch[i] = command
+	}
+
+	resultChan := make(chan QueryResult, 1)
+	req.result = resultChan
+	if err := batch.connection.enqueue(context.Background(), req); err != nil {
+		return nil, err
+	}
+	result := <-resultChan
+
+	if batch.Transactional {
+		return batch.transactionalResults(result)
+	}
+	return batch.syncedResults(result)
+}
+
+func (batch *PgBatch) syncedResults(result QueryResult) ([]BatchResult, error) {
+	if result.err != nil && len(result.batch) == 0 {
+		return nil, result.err
+	}
+
+	var firstErr error
+	results := make([]BatchResult, len(batch.commands))
+	for i, cmd := range batch.commands {
+		if i >= len(result.batch) {
+			// The connection failed before this command's result was read
+			results[i] = BatchResult{CommandTag: ParseCommandTag(""), Err: result.err}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("batch command %d: %w", i+1, result.err)
+			}
+			continue
+		}
+
+		commandResult := result.batch[i]
+		var statementErr *StatementError
+		if errors.As(commandResult.err, &statementErr) {
+			// Each command is a single statement, the index adds nothing
+			commandResult.err = statementErr.Err
+		}
+		if commandResult.err == nil {
+			cmd.readOutputParameters(&commandResult)
+		} else if firstErr == nil {
+			firstErr = fmt.Errorf("batch command %d: %w", i+1, commandResult.err)
+		}
+		results[i] = BatchResult{
+			Columns:    commandResult.Columns,
+			Rows:       commandResult.Rows,
+			CommandTag: commandResult.CommandTag,
+			Err:        commandResult.err,
+		}
+	}
+	return results, firstErr
+}
+
+func (batch *PgBatch) transactionalResults(result QueryResult) ([]BatchResult, error) {
+	var statementErr *StatementError
+	failed := len(batch.commands)
+	if errors.As(result.err, &statementErr) {
+		failed = statementErr.Index
+	} else if result.err != nil {
+		return nil, result.err
+	}
+
+	results := make([]BatchResult, len(batch.commands))
+	for i, cmd := range batch.commands {
+		switch {
+		case i < failed && i < len(result.ResultSets):
+			resultSet := result.ResultSets[i]
+			results[i] = BatchResult{
+				Columns:    resultSet.Columns,
+				Rows:       resultSet.Rows,
+				CommandTag: resultSet.CommandTag,
+			}
+			cmd.readOutputParameters(&QueryResult{Rows: resultSet.Rows})
+		case i == failed:
+			results[i] = BatchResult{CommandTag: ParseCommandTag(""), Err: statementErr.Err}
+		default:
+			results[i] = BatchResult{CommandTag: ParseCommandTag(""), Err: ErrBatchCommandSkipped}
+		}
+	}
+
+	if statementErr != nil {
+		return results, fmt.Errorf("batch command %d: %w", failed+1, statementErr.Err)
+	}
+	return results, nil
+}
+
+// writeBatch writes every command with the extended protocol, describing the
+// portal so each command reports its own columns
+func (conn *PgConnection) writeBatch(buf *bytes.Buffer, req QueryRequest) error {
+	for _, command := range req.batch {
+		statement := ""
+		if command.kind == requestExecutePrepared {
+			statement = command.statement.name
+		} else {
+			conn.writeParse(buf, "", command.query, parameterOIDs(command.params))
+		}
+		if err := conn.writeBind(buf, "", statement, command.params); err != nil {
+			return err
+		}
+		conn.writeDescribe(buf, 'P', "")
+		conn.writeExecute(buf, "", 0)
+		if !req.transactional {
+			conn.writeSync(buf)
+		}
+	}
+	if req.transactional {
+		conn.writeSync(buf)
+	}
+	return nil
+}
+
+// executeBatch sends a batch and reads one response per Sync
+func (conn *PgConnection) executeBatch(req QueryRequest) QueryResult {
+	if err := conn.sendQuery(req); err != nil {
+		return QueryResult{err: err}
+	}
+	if req.transactional {
+		return conn.readQueryResponse(req)
+	}
+
+	results := make([]QueryResult, 0, len(req.batch))
+	for range req.batch {
+		// The portal Describe reports the columns of every command, including
+		// prepared ones, so no cached fields are needed
+		result := conn.readQueryResponse(QueryRequest{kind: requestBatch})
+		if result.err != nil && !isServerError(result.err) {
+			return QueryResult{err: result.err, batch: results}
+		}
+		results = append(results, result)
+	}
+	return QueryResult{batch: results}
+}
@@ -0,0 +1,451 @@
+package client
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgreSQL counts dates and timestamps from 2000-01-01 UTC
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// encodeBinaryValue converts a Go value to the binary wire format of the given
+// type. A nil result with no error means NULL.
+func encodeBinaryValue(oid Oid, value any) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch oid {
+	case BoolOID:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, binaryEncodeError(oid, value)
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case Int2OID:
+		n, err := toInt64(value)
+		if err != nil || n < math.MinInt16 || n > math.MaxInt16 {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(n)), nil
+	case Int4OID:
+		n, err := toInt64(value)
+		if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), nil
+	case OIDOID:
+		n, err := toInt64(value)
+		if err != nil || n < 0 || n > math.MaxUint32 {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), nil
+	case Int8OID:
+		n, err := toInt64(value)
+		if err != nil {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+	case Float4OID:
+		f, err := toFloat64(value)
+		if err != nil {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(f))), nil
+	case Float8OID:
+		f, err := toFloat64(value)
+		if err != nil {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(f)), nil
+	case TextOID, VarcharOID, BPCharOID, NameOID, CharOID, JSONOID, XMLOID, UnknownOID:
+		switch v := value.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		}
+		return []byte(fmt.Sprintf("%v", value)), nil
+	case JSONBOID:
+		// jsonb is its text form prefixed with a version byte
+		switch v := value.(type) {
+		case string:
+			return append([]byte{1}, v...), nil
+		case []byte:
+			return append([]byte{1}, v...), nil
+		}
+		return nil, binaryEncodeError(oid, value)
+	case ByteaOID:
+		b, ok := value.([]byte)
+		if !ok {
+			return nil, binaryEncodeError(oid, value)
+		}
+		return b, nil
+	case UUIDOID:
+		switch v := value.(type) {
+		case [16]byte:
+			return v[:], nil
+		case string:
+			b, err := hex.DecodeString(strings.ReplaceAll(v, "-", ""))
+			if err != nil || len(b) != 16 {
+				return nil, binaryEncodeError(oid, value)
+			}
+			return b, nil
+		}
+		return nil, binaryEncodeError(oid, value)
+	case DateOID:
+		t, ok := value.(time.Time)
+		if !ok {
+			return nil, binaryEncodeError(oid, value)
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days := int32((day.Unix() - postgresEpoch.Unix()) / 86400)
+		return binary.BigEndian.AppendUint32(nil, uint32(days)), nil
+	case TimestampOID, TimestamptzOID:
+		t, ok := value.(time.Time)
+		if !ok {
+			return nil, binaryEncodeError(oid, value)
+		}
+		if oid == TimestampOID {
+			// timestamp without time zone keeps the wall clock time
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		// computed from Unix seconds since time.Duration overflows after 292 years
+		micros := (t.Unix()-postgresEpoch.Unix())*1000000 + int64(t.Nanosecond()/1000)
+		return binary.BigEndian.AppendUint64(nil, uint64(micros)), nil
+	case NumericOID:
+		return encodeBinaryNumeric(value)
+	}
+
+	return nil, fmt.Errorf("binary encoding of type OID %d is not supported", oid)
+}
+
+func binaryEncodeError(oid Oid, value any) error {
+	return fmt.Errorf("cannot encode %T value %v as type OID %d", value, value, oid)
+}
+
+func toInt64(value any) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", v)
+		}
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("%T is not an integer", value)
+}
+
+func toFloat64(value any) (float64, error) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	n, err := toInt64(value)
+	return float64(n), err
+}
+
+const (
+	numericPositive = 0x0000
+	numericNegative = 0x4000
+	numericNaN      = 0xC000
+	numericPInf     = 0xD000
+	numericNInf     = 0xF000
+
+	numericMaxExponent = 1000 // the largest exponent the server accepts
+)
+
+// encodeBinaryNumeric writes a decimal number, which may use an exponent such
+// as 1.5e3, as base-10000 digits with the weight of the first digit and the
+// number of decimal places
+func encodeBinaryNumeric(value any) ([]byte, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case float32:
+		text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		n, err := toInt64(value)
+		if err != nil {
+			return nil, binaryEncodeError(NumericOID, value)
+		}
+		text = strconv.FormatInt(n, 10)
+	}
+
+	// Spelled as the server accepts them, which covers Go's "+Inf" and "-Inf"
+	switch strings.ToLower(text) {
+	case "nan":
+		return encodeNumericSpecial(numericNaN), nil
+	case "infinity", "+infinity", "inf", "+inf":
+		return encodeNumericSpecial(numericPInf), nil
+	case "-infinity", "-inf":
+		return encodeNumericSpecial(numericNInf), nil
+	}
+
+	sign := uint16(numericPositive)
+	if strings.HasPrefix(text, "-") {
+		sign = numericNegative
+		text = text[1:]
+	} else {
+		text = strings.TrimPrefix(text, "+")
+	}
+
+	mantissa, exponent, scientific := strings.Cut(strings.ToLower(text), "e")
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	if intPart == "" && fracPart == "" {
+		return nil, binaryEncodeError(NumericOID, value)
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return nil, binaryEncodeError(NumericOID, value)
+		}
+	}
+	if scientific {
+		// Move the decimal point by the exponent, within the server's limit
+		exp, err := strconv.Atoi(exponent)
+		if err != nil || exp < -numericMaxExponent || exp > numericMaxExponent {
+			return nil, binaryEncodeError(NumericOID, value)
+		}
+		intPart, fracPart = shiftDecimalPoint(intPart, fracPart, exp)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	dscale := len(fracPart)
+
+	// Pad both parts to whole groups of four decimal digits
+	if pad := len(intPart) % 4; pad != 0 {
+		intPart = strings.Repeat("0", 4-pad) + intPart
+	}
+	if pad := len(fracPart) % 4; pad != 0 {
+		fracPart += strings.Repeat("0", 4-pad)
+	}
+
+	digits := make([]uint16, 0, (len(intPart)+len(fracPart))/4)
+	for i := 0; i < len(intPart); i += 4 {
+		d, _ := strconv.Atoi(intPart[i : i+4])
+		digits = append(digits, uint16(d))
+	}
+	for i := 0; i < len(fracPart); i += 4 {
+		d, _ := strconv.Atoi(fracPart[i : i+4])
+		digits = append(digits, uint16(d))
+	}
+	weight := len(intPart)/4 - 1
+
+	// Leading and trailing zero groups are implied by the weight and dscale
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+		weight--
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == 0 {
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		weight = 0
+		sign = numericPositive
+	}
+
+	out := binary.BigEndian.AppendUint16(nil, uint16(len(digits)))
+	out = binary.BigEndian.AppendUint16(out, uint16(int16(weight)))
+	out = binary.BigEndian.AppendUint16(out, sign)
+	out = binary.BigEndian.AppendUint16(out, uint16(dscale))
+	for _, d := range digits {
+		out = binary.BigEndian.AppendUint16(out, d)
+	}
+	return out, nil
+}
+
+// encodeNumericSpecial writes NaN or an infinity, which have no digits
+func encodeNumericSpecial(sign uint16) []byte {
+	out := binary.BigEndian.AppendUint16(nil, 0)
+	out = binary.BigEndian.AppendUint16(out, 0)
+	out = binary.BigEndian.AppendUint16(out, sign)
+	return binary.BigEndian.AppendUint16(out, 0)
+}
+
+// shiftDecimalPoint moves the decimal point between the integer and fraction
+// digits exp places to the right, or to the left for a negative exp
+func shiftDecimalPoint(intPart, fracPart string, exp int) (string, string) {
+	digits := intPart + fracPart
+	point := len(intPart) + exp
+	switch {
+	case point <= 0:
+		return "", strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		return digits + strings.Repeat("0", point-len(digits)), ""
+	default:
+		return digits[:point], digits[point:]
+	}
+}
+
+// decodeBinaryValue converts a value in the binary wire format of the given
+// type to a Go value. Types without a decoder are returned as []byte.
+func decodeBinaryValue(oid Oid, data []byte) (any, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	switch oid {
+	case BoolOID:
+		if len(data) != 1 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return data[0] != 0, nil
+	case Int2OID:
+		if len(data) != 2 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return int16(binary.BigEndian.Uint16(data)), nil
+	case Int4OID:
+		if len(data) != 4 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return int32(binary.BigEndian.Uint32(data)), nil
+	case OIDOID:
+		if len(data) != 4 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return binary.BigEndian.Uint32(data), nil
+	case Int8OID:
+		if len(data) != 8 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case Float4OID:
+		if len(data) != 4 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), nil
+	case Float8OID:
+		if len(data) != 8 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case TextOID, VarcharOID, BPCharOID, NameOID, CharOID, JSONOID, XMLOID, UnknownOID:
+		return string(data), nil
+	case JSONBOID:
+		if len(data) == 0 || data[0] != 1 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		return string(data[1:]), nil
+	case ByteaOID:
+		return append([]byte(nil), data...), nil
+	case UUIDOID:
+		if len(data) != 16 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		text := hex.EncodeToString(data)
+		return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:32], nil
+	case DateOID:
+		if len(data) != 4 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		days := int64(int32(binary.BigEndian.Uint32(data)))
+		return time.Unix(postgresEpoch.Unix()+days*86400, 0).UTC(), nil
+	case TimestampOID, TimestamptzOID:
+		if len(data) != 8 {
+			return nil, binaryDecodeError(oid, data)
+		}
+		micros := int64(binary.BigEndian.Uint64(data))
+		seconds, remainder := micros/1000000, micros%1000000
+		return time.Unix(postgresEpoch.Unix()+seconds, remainder*1000).UTC(), nil
+	case NumericOID:
+		return decodeBinaryNumeric(data)
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func binaryDecodeError(oid Oid, data []byte) error {
+	return fmt.Errorf("cannot decode %d bytes as type OID %d", len(data), oid)
+}
+
+// decodeBinaryNumeric returns the decimal text of a binary numeric
+func decodeBinaryNumeric(data []byte) (string, error) {
+	if len(data) < 8 {
+		return "", binaryDecodeError(NumericOID, data)
+	}
+	ndigits := int(binary.BigEndian.Uint16(data[0:]))
+	weight := int(int16(binary.BigEndian.Uint16(data[2:])))
+	sign := binary.BigEndian.Uint16(data[4:])
+	dscale := int(binary.BigEndian.Uint16(data[6:]))
+	if len(data) != 8+2*ndigits {
+		return "", binaryDecodeError(NumericOID, data)
+	}
+	switch sign {
+	case numericNaN:
+		return "NaN", nil
+	case numericPInf:
+		return "Infinity", nil
+	case numericNInf:
+		return "-Infinity", nil
+	}
+
+	digits := make([]int, ndigits)
+	for i := range digits {
+		digits[i] = int(binary.BigEndian.Uint16(data[8+2*i:]))
+	}
+	digit := func(i int) int {
+		if i < 0 || i >= len(digits) {
+			return 0
+		}
+		return digits[i]
+	}
+
+	var text strings.Builder
+	if sign == numericNegative {
+		text.WriteByte('-')
+	}
+
+	// Groups 0..weight are the integer part, the first without zero padding
+	if weight < 0 {
+		text.WriteByte('0')
+	} else {
+		text.WriteString(strconv.Itoa(digit(0)))
+		for i := 1; i <= weight; i++ {
+			text.WriteString(fmt.Sprintf("%04d", digit(i)))
+		}
+	}
+
+	if dscale > 0 {
+		var fraction strings.Builder
+		for i := weight + 1; fraction.Len() < dscale; i++ {
+			fraction.WriteString(fmt.Sprintf("%04d", digit(i)))
+		}
+		text.WriteByte('.')
+		text.WriteString(fraction.String()[:dscale])
+	}
+	return text.String(), nil
+}
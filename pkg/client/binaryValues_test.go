@@ -0,0 +1,82 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// numeric builds a binary numeric from its header fields and digits
+func numeric(weight int16, sign uint16, dscale uint16, digits ...uint16) []byte {
+	out := binary.BigEndian.AppendUint16(nil, uint16(len(digits)))
+	out = binary.BigEndian.AppendUint16(out, uint16(weight))
+	out = binary.BigEndian.AppendUint16(out, sign)
+	out = binary.BigEndian.AppendUint16(out, dscale)
+	for _, d := range digits {
+		out = binary.BigEndian.AppendUint16(out, d)
+	}
+	return out
+}
+
+func TestBinaryNumericRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		wire  []byte // nil skips the check of the encoding
+		text  string
+	}{
+		{"integer", "12345", numeric(1, numericPositive, 0, 1, 2345), "12345"},
+		{"scale", "12345.678", numeric(1, numericPositive, 3, 1, 2345, 6780), "12345.678"},
+		{"trailing zeros keep the scale", "1.500", numeric(0, numericPositive, 3, 1, 5000), "1.500"},
+		{"fraction only", "0.0001", numeric(-1, numericPositive, 4, 1), "0.0001"},
+		{"small fraction", ".00000123", numeric(-2, numericPositive, 8, 123), "0.00000123"},
+		{"negative", "-98765.4321", numeric(1, numericNegative, 4, 9, 8765, 4321), "-98765.4321"},
+		{"zero", "0", numeric(0, numericPositive, 0), "0"},
+		{"zero with scale", "0.00", numeric(0, numericPositive, 2), "0.00"},
+		{"negative zero", "-0", numeric(0, numericPositive, 0), "0"},
+		{"whole groups of zeros", "100000000", numeric(2, numericPositive, 0, 1), "100000000"},
+		{"explicit plus", "+42", nil, "42"},
+		{"exponent", "1.5e3", nil, "1500"},
+		{"negative exponent", "-25E-4", nil, "-0.0025"},
+		{"NaN", "NaN", numeric(0, numericNaN, 0), "NaN"},
+		{"Infinity", "Infinity", numeric(0, numericPInf, 0), "Infinity"},
+		{"-Infinity", "-infinity", numeric(0, numericNInf, 0), "-Infinity"},
+		{"int64", int64(-9223372036854775808), nil, "-9223372036854775808"},
+		{"float64", 3.25, nil, "3.25"},
+		{"float64 infinity", math.Inf(1), nil, "Infinity"},
+		{"float32 negative infinity", float32(math.Inf(-1)), nil, "-Infinity"},
+		{"float64 NaN", math.NaN(), nil, "NaN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := encodeBinaryNumeric(tt.value)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if tt.wire != nil && !bytes.Equal(encoded, tt.wire) {
+				t.Errorf("encoded as %v, want %v", encoded, tt.wire)
+			}
+			text, err := decodeBinaryNumeric(encoded)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if text != tt.text {
+				t.Errorf("decoded %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestBinaryNumericInvalid(t *testing.T) {
+	for _, value := range []any{"", "-", "+", ".", "e5", "1e", "1e1001", "1x", "1.2.3", "--1", true} {
+		if _, err := encodeBinaryNumeric(value); err == nil {
+			t.Errorf("encoded %#v", value)
+		}
+	}
+	for _, data := range [][]byte{nil, {0, 1, 0, 0, 0, 0, 0, 0}, numeric(0, numericPositive, 0, 1)[:9]} {
+		if _, err := decodeBinaryNumeric(data); err == nil {
+			t.Errorf("decoded %v", data)
+		}
+	}
+}
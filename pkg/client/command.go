@@ -1,41 +1,152 @@
 package client
 
+import "context"
+
 type PgCommand struct {
 	connection  *PgConnection
 	commandText string
-	params      map[string]any
-	paramNames  []string
+	Parameters  *PgParameterCollection
+	prepared    *preparedStatement
 }
 
 func NewPgCommand(commandText string, conn *PgConnection) *PgCommand {
 	return &PgCommand{
 		connection:  conn,
 		commandText: commandText,
-		params:      make(map[string]any),
-		paramNames:  make([]string, 0),
+		Parameters:  NewPgParameterCollection(),
 	}
 }
 
+// SetParameter sets the value for a :name or @name placeholder. Setting the
+// same name again replaces its value. Commands written with $1..$n
+// placeholders bind parameters in the order they were first set.
 func (cmd *PgCommand) SetParameter(name string, value any) {
-	if cmd.params == nil {
-		cmd.params = make(map[string]any)
+	if cmd.Parameters == nil {
+		cmd.Parameters = NewPgParameterCollection()
 	}
-	cmd.params[name] = value
-	cmd.paramNames = append(cmd.paramNames, name)
+	cmd.Parameters.AddWithValue(name, value)
 }
 
 func (cmd *PgCommand) Execute() (*QueryResult, error) {
-	// Create a buffered channel for the query result
+	req, err := cmd.newRequest(nil, nil)
+	if err != nil {
+		return &QueryResult{err: err}, err
+	}
+	// Queue the query and wait for the result
+	result := cmd.send(req)
+	if result.err == nil {
+		cmd.readOutputParameters(&result)
+	}
+	return &result, result.err
+}
+
+// readOutputParameters copies Out and InOut values from the row returned by a
+// CALL into the matching parameters
+func (cmd *PgCommand) readOutputParameters(result *QueryResult) {
+	if cmd.Parameters == nil || len(result.Rows) == 0 {
+		return
+	}
+	row := result.Rows[0]
+	for _, param := range cmd.Parameters.items {
+		if param.Direction == ParameterIn {
+			continue
+		}
+		if value, ok := row[param.Name]; ok {
+			param.Value = value
+		}
+	}
+}
+
+// ExecuteNonQuery runs the command and returns the number of rows affected,
+// or -1 when the command does not report a row count
+func (cmd *PgCommand) ExecuteNonQuery() (int64, error) {
+	result, err := cmd.Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ExecuteScalar returns the first column of the first row, or nil if the
+// command returned no rows
+func (cmd *PgCommand) ExecuteScalar() (any, error) {
+	result, err := cmd.Execute()
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Rows) == 0 || len(result.Columns) == 0 {
+		return nil, nil
+	}
+	return result.Rows[0][result.Columns[0]], nil
+}
+
+// ExecuteReader returns a reader that receives rows as the server sends them
+// instead of buffering the whole result
+func (cmd *PgCommand) ExecuteReader() (*PgDataReader, error) {
 	resultChan := make(chan QueryResult, 1)
-	// Queue the query
-	cmd.connection.queryQueue <- QueryRequest{
-		query:      cmd.commandText,
-		result:     resultChan,
-		params:     cmd.params,
-		paramNames: cmd.paramNames,
+	stream := make(chan streamedRow)
+	req, err := cmd.newRequest(resultChan, stream)
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.connection.enqueue(context.Background(), req); err != nil {
+		return nil, err
 	}
 
-	// Wait for and process the result
-	result := <-resultChan
-	return &result, result.err
+	return &PgDataReader{
+		stream: stream,
+		result: resultChan,
+	}, nil
+}
+
+func (cmd *PgCommand) newRequest(result chan QueryResult, stream chan streamedRow) (QueryRequest, error) {
+	query, params, err := cmd.positionalQuery()
+	if err != nil {
+		return QueryRequest{}, err
+	}
+	req := QueryRequest{
+		query:  query,
+		result: result,
+		stream: stream,
+		params: params,
+	}
+
+	// Reuse the prepared statement unless the command text has changed since
+	if cmd.prepared != nil && cmd.prepared.query == query {
+		req.kind = requestExecutePrepared
+		req.statement = cmd.prepared
+	}
+	return req, nil
+}
+
+// send queues a request and waits for its result
+func (cmd *PgCommand) send(req QueryRequest) QueryResult {
+	resultChan := make(chan QueryResult, 1)
+	req.result = resultChan
+	if err := cmd.connection.enqueue(context.Background(), req); err != nil {
+		return QueryResult{err: err}
+	}
+
+	return <-resultChan
+}
+
+// positionalQuery rewrites named placeholders to $n and returns the
+// parameters in the order they must be bound
+func (cmd *PgCommand) positionalQuery() (string, []*PgParameter, error) {
+	if cmd.Parameters == nil || cmd.Parameters.Len() == 0 {
+		return cmd.commandText, nil, nil
+	}
+	query, names, err := rewriteNamedParameters(cmd.commandText, cmd.Parameters.Contains)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(names) == 0 {
+		return cmd.commandText, cmd.Parameters.All(), nil
+	}
+
+	params := make([]*PgParameter, len(names))
+	for i, name := range names {
+		params[i], _ = cmd.Parameters.Get(name)
+	}
+	return query, params, nil
 }
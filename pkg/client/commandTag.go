@@ -0,0 +1,69 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CommandTag is the parsed CommandComplete tag of a single statement
+type CommandTag struct {
+	Command      string // command verb, e.g. "INSERT" or "CREATE TABLE"
+	OID          uint32 // OID of the inserted row for INSERT, always 0 on modern servers
+	RowsAffected int64  // -1 when the command does not report a row count
+	Raw          string
+}
+
+func ParseCommandTag(tag string) CommandTag {
+	commandTag := CommandTag{Command: tag, RowsAffected: -1, Raw: tag}
+
+	parts := strings.Fields(tag)
+	if len(parts) < 2 {
+		return commandTag
+	}
+
+	switch parts[0] {
+	case "INSERT":
+		// INSERT oid rows
+		if len(parts) != 3 {
+			return commandTag
+		}
+		oid, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return commandTag
+		}
+		rows, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return commandTag
+		}
+		commandTag.Command = parts[0]
+		commandTag.OID = uint32(oid)
+		commandTag.RowsAffected = rows
+	case "SELECT", "UPDATE", "DELETE", "MERGE", "MOVE", "FETCH", "COPY":
+		// verb rows
+		if len(parts) != 2 {
+			return commandTag
+		}
+		rows, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return commandTag
+		}
+		commandTag.Command = parts[0]
+		commandTag.RowsAffected = rows
+	}
+
+	return commandTag
+}
+
+// modifiesRows reports whether the row count is of rows the statement changed
+func (tag CommandTag) modifiesRows() bool {
+	switch tag.Command {
+	case "INSERT", "UPDATE", "DELETE", "MERGE":
+		return tag.RowsAffected >= 0
+	default:
+		return false
+	}
+}
+
+func (tag CommandTag) String() string {
+	return tag.Raw
+}
@@ -0,0 +1,28 @@
+package client
+
+import "testing"
+
+func TestRowsAffected(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want int64
+	}{
+		{[]string{"INSERT 0 2"}, 2},
+		{[]string{"UPDATE 3", "DELETE 4", "MERGE 1"}, 8},
+		{[]string{"SELECT 10", "UPDATE 3"}, 3},
+		{[]string{"UPDATE 0"}, 0},
+		{[]string{"SELECT 10"}, -1},
+		{[]string{"FETCH 5", "MOVE 2", "COPY 7"}, -1},
+		{[]string{"CREATE TABLE"}, -1},
+		{nil, -1},
+	}
+	for _, tt := range tests {
+		result := &QueryResult{}
+		for _, tag := range tt.tags {
+			result.CommandTags = append(result.CommandTags, ParseCommandTag(tag))
+		}
+		if got := result.RowsAffected(); got != tt.want {
+			t.Errorf("%v: RowsAffected() = %d, want %d", tt.tags, got, tt.want)
+		}
+	}
+}
@@ -3,25 +3,80 @@ package client
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mparavac97/PgClient/pkg/message"
 )
 
+type requestKind int
+
+const (
+	requestQuery requestKind = iota
+	requestOpenPortal
+	requestFetchPortal
+	requestClosePortal
+	requestPrepare
+	requestExecutePrepared
+	requestUnprepare
+	requestPrepareExecute
+	requestExecuteDescribed
+	requestDescribe
+	requestBatch
+	requestCopyIn
+	requestCopyOut
+)
+
 type QueryRequest struct {
-	query      string
-	params     map[string]any
-	paramNames []string
-	result     chan QueryResult
+	kind      requestKind
+	query     string
+	params    []*PgParameter // in positional order
+	portal    string
+	maxRows   int32
+	statement *preparedStatement
+	batch     []QueryRequest // commands of a batch request
+	// transactional batches share a single Sync and so a single implicit transaction
+	transactional bool
+	copySource    io.Reader        // data sent to the server for COPY FROM STDIN
+	copyTarget    io.Writer        // receives the data of COPY TO STDOUT
+	ctx           context.Context  // cancels a COPY while data is streaming
+	stream        chan streamedRow // when set, data rows are sent here instead of collected
+	trace         *traceSpan       // set when the connection picks the request up
+	started       time.Time        // when the connection picked the request up, for metrics
+	onSuccess     func()           // runs on the connection goroutine before a successful result is handed back
+	result        chan QueryResult
 }
 
 type QueryResult struct {
-	Rows []map[string]any
-	err  error
+	Columns     []string         // columns of the last result set
+	Rows        []map[string]any // rows of the last result set
+	ResultSets  []ResultSet      // one entry per statement executed, in order
+	Suspended   bool             // the portal row limit was reached before all rows were returned
+	CommandTag  CommandTag       // tag of the last statement executed
+	CommandTags []CommandTag     // tags of every statement executed, in order
+	paramOIDs   []Oid            // from the last ParameterDescription
+	fields      []RowDescription // from the last RowDescription
+	batch       []QueryResult    // per-command results of a non-transactional batch
+	err         error
+}
+
+// ResultSet holds the outcome of a single statement
+type ResultSet struct {
+	Columns    []string
+	Rows       []map[string]any
+	CommandTag CommandTag
+}
+
+type streamedRow struct {
+	columns []string
+	values  map[string]any
 }
 
 type ConnectionDetails struct {
@@ -31,6 +86,21 @@ type ConnectionDetails struct {
 	Password          string
 	Database          string
 	ConnectionTimeout string // in seconds
+	// Pipeline sends queued extended-protocol queries back to back before
+	// reading their results, up to PipelineDepth at a time
+	Pipeline      string
+	PipelineDepth string
+	// StatementCacheMode is "prepare" (default), "describe" or "disable"
+	StatementCacheMode     string
+	StatementCacheCapacity string
+	// MaxMessageSize is the largest message, in bytes, accepted from the server
+	MaxMessageSize string
+	// ProtocolVersion is the protocol version requested, "3.0" (default) or
+	// "3.2"; older servers negotiate it down
+	ProtocolVersion string
+	// ProtocolOptions are the _pq_ options sent in the startup message, taken
+	// from connection string keys starting with "_pq_."
+	ProtocolOptions map[string]string
 }
 
 type RowDescription struct {
@@ -44,13 +114,34 @@ type RowDescription struct {
 }
 
 type PgConnection struct {
-	details           ConnectionDetails
-	writer            *message.PgWriter
-	reader            *message.PgReader
-	client            *TCPClient
-	connParams        map[string]string
-	TransactionStatus string
-	queryQueue        chan QueryRequest
+	details                ConnectionDetails
+	writer                 *message.PgWriter
+	reader                 *message.PgReader
+	client                 *TCPClient
+	connParams             map[string]string // run-time parameters reported by the server
+	backendPID             int32
+	secretKey              []byte // sent with the PID to cancel a running query
+	protocolVersion        int32  // as agreed with the server
+	unrecognizedOptions    []string
+	mu                     sync.RWMutex
+	noticeHandler          func(notice *Notice)
+	parameterStatusHandler func(name, value string)
+	handlers               map[byte]message.ResponseHandler // by backend message type
+	tracer                 Tracer
+	metrics                *Metrics
+	wireTrace              *message.WireTrace
+	baseLogger             *slog.Logger // as set by SetLogger
+	log                    *slog.Logger // baseLogger with the connection attributes
+	TransactionStatus      string
+	queryQueue             chan QueryRequest
+	statements             *statementCache
+	pendingCloses          []string     // evicted statements to close with the next request
+	pipelineDepth          int          // 0 when pipelining is disabled
+	multiplexed            bool         // shares its queue with other connections of a PgMultiplexer
+	sharedQueue            *sharedQueue // set when multiplexed, tells whether the queue is closed
+	notifications          chan Notification
+	listening              atomic.Bool // LISTEN was issued, so the socket is read while idle
+	idleErr                error       // why reading the idle connection stopped
 }
 
 const (
@@ -68,21 +159,44 @@ const (
 
 func NewPgConnection(connectionString string) *PgConnection {
 	details := parseConnectionString(connectionString)
-	client := NewTCPClient(details.Host, details.Port)
-
-	conn := &PgConnection{
-		details:    details,
-		client:     client,
-		connParams: make(map[string]string),
-		queryQueue: make(chan QueryRequest, 100), // buffered channel to hold up to 100 queries
-	}
+	conn := newPgConnection(details, make(chan QueryRequest, 100)) // buffered channel to hold up to 100 queries
 
 	go conn.ProcessQueries()
 	return conn
 }
 
+func newPgConnection(details ConnectionDetails, queryQueue chan QueryRequest) *PgConnection {
+	client := NewTCPClient(details.Host, details.Port)
+
+	return &PgConnection{
+		details:       details,
+		client:        client,
+		connParams:    make(map[string]string),
+		handlers:      message.InitializeHandlers(),
+		queryQueue:    queryQueue,
+		notifications: make(chan Notification, notificationBufferSize),
+		baseLogger:    discardLogger,
+		log:           discardLogger,
+		statements: newStatementCache(
+			parseStatementCacheMode(details.StatementCacheMode),
+			parseStatementCacheCapacity(details.StatementCacheCapacity),
+		),
+		pipelineDepth: parsePipelineDepth(details.Pipeline, details.PipelineDepth),
+	}
+}
+
 func (conn *PgConnection) Connect() error {
-	fmt.Println("Connecting to server...")
+	span := conn.startTrace(context.Background(), TraceStartData{Event: TraceConnect})
+	err := conn.connect()
+	conn.endTrace(span, -1, err)
+	if metrics := conn.currentMetrics(); metrics != nil {
+		metrics.observeConnect(err)
+	}
+	return err
+}
+
+func (conn *PgConnection) connect() error {
+	conn.logger().Info("connecting", slog.String("port", conn.details.Port))
 
 	// Create a context with timeout or use background context for no timeout
 	var ctx context.Context
@@ -108,11 +222,17 @@ func (conn *PgConnection) Connect() error {
 		}
 
 		// Initialize writer and reader AFTER the connection exists
-		conn.writer = message.NewPgWriter(conn.client.conn)
-		conn.reader = message.NewPgReader(conn.client.conn)
+		var reader io.Reader = conn.client.conn
+		var writer io.Writer = conn.client.conn
+		if conn.wireTrace != nil {
+			reader = conn.wireTrace.Reader(reader)
+			writer = conn.wireTrace.Writer(writer)
+		}
+		conn.writer = message.NewPgWriter(writer)
+		conn.reader = message.NewPgReader(reader)
+		conn.reader.SetMaxMessageSize(parseMaxMessageSize(conn.details.MaxMessageSize))
 
-		fmt.Println("Connected to server.")
-		fmt.Println("Sending startup message...")
+		conn.logger().Debug("sending startup message", slog.String("username", conn.details.Username))
 		if err = conn.sendStartupMessage(); err != nil {
 			done <- err
 			return
@@ -120,52 +240,42 @@ func (conn *PgConnection) Connect() error {
 
 		// Handle server messages until ReadyForQuery
 		for {
-			msgType, err := conn.reader.ReadByte()
-			if err != nil {
-				done <- fmt.Errorf("error reading message type: %w", err)
-				return
-			}
-			fmt.Println("Received message type:", message.MessageType(msgType).String())
-			length, err := conn.reader.ReadInt32()
+			msg, err := conn.readBackendMessage()
 			if err != nil {
-				done <- fmt.Errorf("error reading message type: %w", err)
+				done <- err
 				return
 			}
 
-			switch msgType {
-			case byte(message.ParameterStatus):
-				param, value, err := message.ProcessParameterStatus(conn.reader)
-				if err != nil {
-					done <- fmt.Errorf("error processing parameter status: %w", err)
-					return
-				}
-				conn.connParams[param] = value
-			case byte(message.BackendKeyData):
-				pid, key, err := message.ProcessBackendKeyData(conn.reader)
-				if err != nil {
-					done <- fmt.Errorf("error processing backend key data: %w", err)
-					return
+			switch msg := msg.(type) {
+			case *message.ParameterStatusMessage:
+				conn.receiveParameterStatus(msg)
+			case *message.ErrorFieldsMessage:
+				if msg.Type == message.NoticeResponse {
+					conn.receiveNotice(msg)
+					break
 				}
-				conn.connParams["pid"] = fmt.Sprintf("%d", pid)
-				conn.connParams["key"] = fmt.Sprintf("%d", key)
-			case byte(message.ReadyForQuery):
-				status, err := message.ProcessReadyForQuery(conn.reader)
-				if err != nil {
-					done <- fmt.Errorf("error processing ready for query: %w", err)
+				pgErr := newPgError(msg.Fields)
+				conn.logger().Error("server rejected connection", slog.Any("error", pgErr))
+				done <- pgErr
+				return
+			case *message.NegotiateProtocolVersionMessage:
+				if err := conn.negotiateProtocol(parseProtocolVersion(conn.details.ProtocolVersion), msg); err != nil {
+					done <- err
 					return
 				}
-				conn.TransactionStatus = status
+			case *message.BackendKeyDataMessage:
+				conn.mu.Lock()
+				conn.backendPID = msg.ProcessID
+				conn.secretKey = msg.SecretKey
+				conn.log = conn.connectionLogger()
+				conn.mu.Unlock()
+			case *message.ReadyForQueryMessage:
+				conn.TransactionStatus = string(msg.TxStatus)
+				// The connection timeout only covers the handshake
+				conn.client.conn.SetDeadline(time.Time{})
+				conn.logger().Info("connected")
 				done <- nil
 				return
-			case byte(message.ErrorResponse):
-				errResponse, err := message.ProcessErrorResponse(conn.reader, length)
-				if err != nil {
-					done <- fmt.Errorf("error processing error response: %w", err)
-				}
-				fmt.Println("server returned error response: ", errResponse)
-			default:
-				conn.reader.SkipN(length - 4)
-				fmt.Println("Found default message type.")
 			}
 		}
 	}()
@@ -190,144 +300,304 @@ func (conn *PgConnection) Close() error {
 	return nil
 }
 
-func (conn *PgConnection) sendQuery(query string, params map[string]any, paramNames []string) error {
+// enqueue hands a request to the goroutine that owns the socket
+func (conn *PgConnection) enqueue(ctx context.Context, req QueryRequest) error {
+	if conn.sharedQueue != nil {
+		return conn.sharedQueue.send(ctx, conn.queryQueue, req)
+	}
+	select {
+	case conn.queryQueue <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (conn *PgConnection) sendQuery(req QueryRequest) error {
 	buf := new(bytes.Buffer)
-	if len(params) == 0 {
-		buf.WriteByte(byte(message.Query))
-		binary.Write(buf, binary.BigEndian, int32(len(query)+5))
-		conn.writer.WriteCString(buf, query)
-		fmt.Println("Sending query:", query)
-		_, err := conn.writer.Write(buf.Bytes())
+	conn.writePendingCloses(buf)
+	if err := conn.writeRequest(buf, req); err != nil {
 		return err
-	} else {
-		// extended query protocol
-		// 1. Parse message
-		parseBuf := new(bytes.Buffer)
-		conn.writer.WriteCString(parseBuf, "")                       // unnamed statement
-		conn.writer.WriteCString(parseBuf, query)                    // query string
-		binary.Write(parseBuf, binary.BigEndian, int16(len(params))) // number of parameter types
-		for range params {
-			binary.Write(parseBuf, binary.BigEndian, int32(0)) // parameter type OID (0 = unspecified)
-		}
-
-		// Write Parse message header
-		buf.WriteByte('P')                                           // Parse message type
-		binary.Write(buf, binary.BigEndian, int32(parseBuf.Len()+4)) // message length including itself
-		buf.Write(parseBuf.Bytes())
+	}
 
-		// _, err := conn.writer.Write(buf.Bytes())
-		// if err != nil {
-		// 	return err
-		// }
+	if err := conn.writeMessages(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing messages: %w", err)
+	}
+	return nil
+}
 
-		// 2. Describe message - describes the prepared statement
-		buf.WriteByte('D') // Describe message type
-		describeBuf := new(bytes.Buffer)
-		describeBuf.WriteByte('S')                // Describe a prepared statement ('S'), not a portal ('P')
-		conn.writer.WriteCString(describeBuf, "") // unnamed statement
-		binary.Write(buf, binary.BigEndian, int32(describeBuf.Len()+4))
-		buf.Write(describeBuf.Bytes())
+// writePendingCloses closes statements evicted from the cache ahead of the
+// next request; their CloseComplete replies are skipped by readQueryResponse
+func (conn *PgConnection) writePendingCloses(buf *bytes.Buffer) {
+	for _, name := range conn.pendingCloses {
+		conn.writeClose(buf, 'S', name)
+	}
+	conn.pendingCloses = nil
+}
 
-		// 3. Bind
-		buf.WriteByte('B')
-		bindInner := new(bytes.Buffer)
-		conn.writer.WriteCString(bindInner, "") // unnamed portal
-		conn.writer.WriteCString(bindInner, "") // unnamed prepared statement
-
-		// Format codes for parameters (use text format)
-		binary.Write(bindInner, binary.BigEndian, int16(len(params)))
-		for range params {
-			binary.Write(bindInner, binary.BigEndian, int16(0))
+func (conn *PgConnection) writeRequest(buf *bytes.Buffer, req QueryRequest) error {
+	switch req.kind {
+	case requestOpenPortal:
+		// Parse into the unnamed statement and bind it to a named portal; the
+		// portal stays open until the surrounding transaction ends
+		conn.writeParse(buf, "", req.query, parameterOIDs(req.params))
+		if err := conn.writeBind(buf, req.portal, "", req.params); err != nil {
+			return err
 		}
-
-		// Parameter values
-		binary.Write(bindInner, binary.BigEndian, int16(len(params)))
-		for _, param := range paramNames {
-			paramStr := fmt.Sprintf("%v", params[param])
-			binary.Write(bindInner, binary.BigEndian, int32(len(paramStr)))
-			bindInner.WriteString(paramStr)
+		conn.writeSync(buf)
+		conn.logger().Debug("opening portal", slog.String("portal", req.portal), slog.Int("params", len(req.params)))
+	case requestFetchPortal:
+		// Describe the portal so the row layout is known, then fetch the next chunk
+		conn.writeDescribe(buf, 'P', req.portal)
+		conn.writeExecute(buf, req.portal, req.maxRows)
+		conn.writeSync(buf)
+		conn.logger().Debug("fetching from portal", slog.String("portal", req.portal), slog.Int("rows", int(req.maxRows)))
+	case requestClosePortal:
+		conn.writeClose(buf, 'P', req.portal)
+		conn.writeSync(buf)
+		conn.logger().Debug("closing portal", slog.String("portal", req.portal))
+	case requestPrepare:
+		conn.writeParse(buf, req.statement.name, req.statement.query, parameterOIDs(req.params))
+		conn.writeDescribe(buf, 'S', req.statement.name)
+		conn.writeSync(buf)
+		conn.logger().Debug("preparing statement", slog.String("statement", req.statement.name), slog.String("sql", req.statement.query))
+	case requestPrepareExecute:
+		// Prepare a named statement for the cache and run it in the same round trip
+		conn.writeParse(buf, req.statement.name, req.query, parameterOIDs(req.params))
+		conn.writeDescribe(buf, 'S', req.statement.name)
+		if err := conn.writeBind(buf, "", req.statement.name, req.params); err != nil {
+			return err
+		}
+		conn.writeExecute(buf, "", 0)
+		conn.writeSync(buf)
+		conn.logger().Debug("preparing and executing statement", slog.String("statement", req.statement.name), slog.String("sql", req.query), slog.Int("params", len(req.params)))
+	case requestExecuteDescribed:
+		// Re-parse the unnamed statement with the cached parameter types. The
+		// portal is described every time since, unlike a named statement, a
+		// re-parsed one never fails over a changed table but returns its
+		// new columns.
+		conn.writeParse(buf, "", req.query, req.statement.paramOIDs)
+		if err := conn.writeBind(buf, "", "", req.params); err != nil {
+			return err
+		}
+		conn.writeDescribe(buf, 'P', "")
+		conn.writeExecute(buf, "", 0)
+		conn.writeSync(buf)
+	case requestExecutePrepared:
+		// The statement is already parsed and described, only bind and run it
+		if err := conn.writeBind(buf, "", req.statement.name, req.params); err != nil {
+			return err
+		}
+		conn.writeExecute(buf, "", 0)
+		conn.writeSync(buf)
+		conn.logger().Debug("executing prepared statement", slog.String("statement", req.statement.name), slog.Int("params", len(req.params)))
+	case requestDescribe:
+		conn.writeParse(buf, "", req.query, nil)
+		conn.writeDescribe(buf, 'S', "")
+		conn.writeSync(buf)
+		conn.logger().Debug("describing query", slog.String("sql", req.query))
+	case requestBatch:
+		conn.logger().Debug("sending batch", slog.Int("commands", len(req.batch)))
+		return conn.writeBatch(buf, req)
+	case requestCopyIn, requestCopyOut:
+		conn.writeQuery(buf, req.query)
+	case requestUnprepare:
+		conn.writeClose(buf, 'S', req.statement.name)
+		conn.writeSync(buf)
+		conn.logger().Debug("closing prepared statement", slog.String("statement", req.statement.name))
+	default:
+		if len(req.params) == 0 {
+			conn.writeQuery(buf, req.query)
+			break
 		}
 
-		// Result format codes (use text format for all)
-		binary.Write(bindInner, binary.BigEndian, int16(0))
+		// extended query protocol
+		// 1. Parse message
+		conn.writeParse(buf, "", req.query, parameterOIDs(req.params))
+		// 2. Describe message - describes the prepared statement
+		conn.writeDescribe(buf, 'S', "")
+		// 3. Bind
+		if err := conn.writeBind(buf, "", "", req.params); err != nil {
+			return err
+		}
+		// 4. Execute
+		conn.writeExecute(buf, "", 0)
+		// 5. Sync
+		conn.writeSync(buf)
+	}
+	return nil
+}
 
-		binary.Write(buf, binary.BigEndian, int32(bindInner.Len()+4))
-		buf.Write(bindInner.Bytes())
+func (conn *PgConnection) writeQuery(buf *bytes.Buffer, query string) {
+	buf.Write((&message.QueryMessage{SQL: query}).Encode(buf.AvailableBuffer()))
+	conn.logger().Debug("sending query", slog.String("sql", query))
+}
 
-		// 4. Execute
-		buf.WriteByte('E')
-		binary.Write(buf, binary.BigEndian, int32(9)) // message length
-		conn.writer.WriteCString(buf, "")             // unnamed portal
-		binary.Write(buf, binary.BigEndian, int32(0)) // unlimited rows
+func (conn *PgConnection) writeParse(buf *bytes.Buffer, statement string, query string, paramOIDs []Oid) {
+	msg := &message.ParseMessage{
+		Name:          statement, // empty for unnamed
+		SQL:           query,
+		ParameterOIDs: make([]uint32, len(paramOIDs)),
+	}
+	for i, oid := range paramOIDs {
+		msg.ParameterOIDs[i] = uint32(oid) // 0 = unspecified
+	}
+	buf.Write(msg.Encode(buf.AvailableBuffer()))
+}
 
-		// 5. Sync
-		buf.WriteByte('S')
-		binary.Write(buf, binary.BigEndian, int32(4))
+// writeDescribe describes either a prepared statement ('S') or a portal ('P')
+func (conn *PgConnection) writeDescribe(buf *bytes.Buffer, target byte, name string) {
+	buf.Write((&message.DescribeMessage{Target: target, Name: name}).Encode(buf.AvailableBuffer()))
+}
 
-		_, err := conn.writer.Write(buf.Bytes())
+func (conn *PgConnection) writeBind(buf *bytes.Buffer, portal string, statement string, params []*PgParameter) error {
+	msg := &message.BindMessage{
+		Portal:           portal,    // empty for unnamed
+		Statement:        statement, // empty for unnamed
+		ParameterFormats: make([]int16, len(params)),
+		Parameters:       make([][]byte, len(params)),
+		// No result formats, so every column comes back as text
+	}
+	for i, param := range params {
+		value, err := param.encode()
 		if err != nil {
-			return fmt.Errorf("error writing messages: %w", err)
+			return err
 		}
-		return nil
+		msg.ParameterFormats[i] = param.Format
+		msg.Parameters[i] = value
 	}
+	buf.Write(msg.Encode(buf.AvailableBuffer()))
+	return nil
+}
+
+// writeExecute runs a bound portal; maxRows of 0 fetches all remaining rows
+func (conn *PgConnection) writeExecute(buf *bytes.Buffer, portal string, maxRows int32) {
+	buf.Write((&message.ExecuteMessage{Portal: portal, MaxRows: maxRows}).Encode(buf.AvailableBuffer()))
+}
+
+// writeClose closes either a prepared statement ('S') or a portal ('P')
+func (conn *PgConnection) writeClose(buf *bytes.Buffer, target byte, name string) {
+	buf.Write((&message.CloseMessage{Target: target, Name: name}).Encode(buf.AvailableBuffer()))
+}
+
+func (conn *PgConnection) writeSync(buf *bytes.Buffer) {
+	buf.Write((&message.SyncMessage{}).Encode(buf.AvailableBuffer()))
 }
 
 func (conn *PgConnection) ProcessQueries() {
-	for req := range conn.queryQueue {
-		err := conn.sendQuery(req.query, req.params, req.paramNames)
-		if err != nil {
-			req.result <- QueryResult{nil, err}
-			continue
+	for {
+		req, ok := conn.nextRequest()
+		if !ok {
+			return
 		}
-
-		// Read the response
-		rows := conn.readQueryResponse()
-		req.result <- QueryResult{rows, nil}
+		req = conn.beginRequest(req)
+		if conn.pipelineDepth > 1 && canPipeline(req) {
+			// runPipeline hands back the first queued request it could not pipeline
+			next := conn.runPipeline(req)
+			if next == nil {
+				continue
+			}
+			req = *next
+		}
+		conn.complete(req, conn.execute(req))
 	}
 }
 
-func (conn *PgConnection) sendStartupMessage() error {
-	buf := new(bytes.Buffer)
-	// protocol version number 3.0 - 196608
-	binary.Write(buf, binary.BigEndian, int32(196608))
-
-	conn.writer.WriteCString(buf, "user")
-	conn.writer.WriteCString(buf, conn.details.Username)
+func (conn *PgConnection) execute(req QueryRequest) QueryResult {
+	// Checked here, on the goroutine that owns TransactionStatus
+	if req.kind == requestOpenPortal && conn.TransactionStatus == "I" {
+		return QueryResult{err: ErrPortalOutsideTransaction}
+	}
+	if conn.cacheable(req) {
+		return conn.executeCached(req)
+	}
+	if req.kind == requestBatch {
+		return conn.executeBatch(req)
+	}
+	return conn.roundTrip(req)
+}
 
-	conn.writer.WriteCString(buf, "database")
-	conn.writer.WriteCString(buf, conn.details.Database)
+// complete hands the result back to the caller waiting on the request
+func (conn *PgConnection) complete(req QueryRequest, result QueryResult) {
+	if conn.multiplexed && result.err == nil && conn.TransactionStatus != "I" {
+		result.err = conn.abortMultiplexedTransaction()
+	}
+	if req.onSuccess != nil && result.err == nil {
+		req.onSuccess()
+	}
+	conn.endRequestTrace(req, result)
+	conn.observeRequest(req, result)
+	if req.stream != nil {
+		close(req.stream)
+	}
+	req.result <- result
+}
 
-	conn.writer.WriteCString(buf, "application_name")
-	conn.writer.WriteCString(buf, "PgClient")
+// roundTrip sends a request and reads its response up to ReadyForQuery
+func (conn *PgConnection) roundTrip(req QueryRequest) QueryResult {
+	if err := conn.sendQuery(req); err != nil {
+		return QueryResult{err: err}
+	}
+	// Read the response
+	return conn.readQueryResponse(req)
+}
 
-	buf.WriteByte(0)
+func (conn *PgConnection) sendStartupMessage() error {
+	msg := &message.StartupMessage{
+		ProtocolVersion: parseProtocolVersion(conn.details.ProtocolVersion),
+		Parameters: map[string]string{
+			"user":             conn.details.Username,
+			"database":         conn.details.Database,
+			"application_name": "PgClient",
+		},
+	}
+	for name, value := range conn.details.ProtocolOptions {
+		msg.Parameters[name] = value
+	}
+	frame := msg.Encode(nil)
 
-	msg := buf.Bytes()
-	final := new(bytes.Buffer)
-	binary.Write(final, binary.BigEndian, int32(len(msg)+4))
-	final.Write(msg)
+	// Unless the server negotiates, it speaks the version requested
+	conn.mu.Lock()
+	conn.protocolVersion = msg.ProtocolVersion
+	conn.unrecognizedOptions = nil
+	conn.mu.Unlock()
 
 	if conn.writer == nil {
 		return fmt.Errorf("writer is not initialized")
 	} else {
-		_, err := conn.writer.Write(final.Bytes())
+		if metrics := conn.currentMetrics(); metrics != nil {
+			metrics.observeWrittenMessage("StartupMessage", len(frame))
+		}
+		_, err := conn.writer.Write(frame)
 		return err
 	}
 }
 
+func parseMaxMessageSize(value string) int {
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return message.DefaultMaxMessageSize
+	}
+	return size
+}
+
 func parseConnectionString(connString string) ConnectionDetails {
-	fmt.Println(connString)
 	split := strings.Split(connString, ";")
-	fmt.Println(split)
 	details := ConnectionDetails{}
 
 	assignMap := map[string]*string{
-		"host":              &details.Host,
-		"port":              &details.Port,
-		"username":          &details.Username,
-		"password":          &details.Password,
-		"database":          &details.Database,
-		"connectiontimeout": &details.ConnectionTimeout,
+		"host":                   &details.Host,
+		"port":                   &details.Port,
+		"username":               &details.Username,
+		"password":               &details.Password,
+		"database":               &details.Database,
+		"connectiontimeout":      &details.ConnectionTimeout,
+		"statementcachemode":     &details.StatementCacheMode,
+		"statementcachecapacity": &details.StatementCacheCapacity,
+		"pipeline":               &details.Pipeline,
+		"pipelinedepth":          &details.PipelineDepth,
+		"maxmessagesize":         &details.MaxMessageSize,
+		"protocolversion":        &details.ProtocolVersion,
 	}
 
 	for _, part := range split {
@@ -343,180 +613,258 @@ func parseConnectionString(connString string) ConnectionDetails {
 
 		if ptr, ok := assignMap[key]; ok {
 			*ptr = value
+		} else if strings.HasPrefix(key, protocolOptionPrefix) {
+			if details.ProtocolOptions == nil {
+				details.ProtocolOptions = make(map[string]string)
+			}
+			details.ProtocolOptions[key] = value
 		}
 	}
 
 	return details
 }
 
-func (conn *PgConnection) readQueryResponse() []map[string]any {
+func (conn *PgConnection) readQueryResponse(req QueryRequest) QueryResult {
+	var serverErr error
+	commandTags := make([]CommandTag, 0)
+	resultSets := make([]ResultSet, 0)
+	suspended := false
 	fields := make([]RowDescription, 0)
-	rows := make([]map[string]any, 0)
-	for {
-		msgType, err := conn.reader.ReadByte()
-		if err != nil {
-			fmt.Println("error reading message type:", err)
-			return nil
+	current := newResultSet()
+	var paramOIDs []Oid
+	var described []RowDescription
+	var copyErr error
+	// A message that could not be used fails the request, but the rest of
+	// the response is still read so the next request starts on a clean stream
+	var protocolErr error
+	failProtocol := func(err error) {
+		if protocolErr == nil {
+			protocolErr = err
 		}
-		fmt.Printf("[ReadQueryResponse] Received message of type: %s\n", message.MessageType(msgType).String())
-		_, err = conn.reader.ReadInt32()
+	}
+
+	// A prepared or cached statement was described earlier, so the server
+	// will not send a RowDescription for it again
+	if req.kind == requestExecutePrepared {
+		fields = req.statement.fields
+		current.Columns = columnNames(fields)
+	}
+
+	// Every statement ends with CommandComplete, EmptyQueryResponse or
+	// PortalSuspended; the next one starts with its own RowDescription
+	finishResultSet := func(tag CommandTag) {
+		current.CommandTag = tag
+		resultSets = append(resultSets, current)
+		current = newResultSet()
+		fields = make([]RowDescription, 0)
+	}
+
+	for {
+		msg, err := conn.readBackendMessage()
 		if err != nil {
-			fmt.Println("error reading message length:", err)
-			return nil
+			var msgErr *messageError
+			if !errors.As(err, &msgErr) || msgErr.msgType == message.ReadyForQuery {
+				return QueryResult{err: err}
+			}
+			failProtocol(err)
+			continue
 		}
-		switch msgType {
-		case byte(message.ParameterDescription):
-			paramCount, err := conn.reader.ReadInt16()
-			if err != nil {
-				fmt.Println("error reading parameter count:", err)
-				return nil
+		switch msg := msg.(type) {
+		case *message.ParameterDescriptionMessage:
+			paramOIDs = make([]Oid, len(msg.ParameterOIDs))
+			for i, oid := range msg.ParameterOIDs {
+				paramOIDs[i] = Oid(oid)
 			}
-			// Read parameter type OIDs
-			for i := 0; i < int(paramCount); i++ {
-				oid, err := conn.reader.ReadInt32() // parameter type OID
-				if err != nil {
-					fmt.Println("error reading parameter type:", err)
-					return nil
+		case *message.RowDescriptionMessage:
+			fields = make([]RowDescription, len(msg.Fields))
+			for i, field := range msg.Fields {
+				fields[i] = RowDescription{
+					fieldName:             field.Name,
+					tableObjectId:         int32(field.TableOID),
+					attributeNumber:       field.AttributeNumber,
+					fieldDataTypeObjectId: int32(field.DataTypeOID),
+					dataTypeSize:          field.DataTypeSize,
+					typeModifier:          field.TypeModifier,
+					formatCode:            field.Format,
 				}
-				fmt.Println("Parameter", i, "type OID:", oid)
-			}
-		case byte(message.RowDescription):
-			noOfFields, err := conn.reader.ReadInt16()
-			if err != nil {
-				fmt.Println("error reading no of fields:", err)
-				return nil
 			}
-
-			i := 0
-			for i < int(noOfFields) {
-				row := new(RowDescription)
-
-				fieldName, _ := conn.reader.ReadCString()
-				row.fieldName = fieldName
-				row.tableObjectId, _ = conn.reader.ReadInt32()
-				row.attributeNumber, _ = conn.reader.ReadInt16()
-				row.fieldDataTypeObjectId, _ = conn.reader.ReadInt32()
-				row.dataTypeSize, _ = conn.reader.ReadInt16()
-				row.typeModifier, _ = conn.reader.ReadInt32()
-				row.formatCode, _ = conn.reader.ReadInt16()
-
-				fields = append(fields, *row)
-				i++
-			}
-		case byte(message.DataRow):
-			noOfFields, err := conn.reader.ReadInt16()
-			if err != nil {
-				fmt.Println("error reading no of fields in data row:", err)
-				return nil
+			current.Columns = columnNames(fields)
+			described = fields
+		case *message.NoDataMessage:
+			described = make([]RowDescription, 0)
+		case *message.DataRowMessage:
+			if len(msg.Values) > len(fields) {
+				failProtocol(fmt.Errorf("data row has %d values for %d columns", len(msg.Values), len(fields)))
+				break
 			}
-
-			i := 0
 			data := make(map[string]any)
-			for i < int(noOfFields) {
-				valueLength, err := conn.reader.ReadInt32()
-				if err != nil {
-					fmt.Println("error reading value length:", err)
-					return nil
-				}
-				if valueLength < 0 { //-1 indicates a NULL column value
+			for i, value := range msg.Values {
+				switch {
+				case value == nil: // NULL column value
 					data[fields[i].fieldName] = nil
-				} else {
-					var value any
-					if fields[i].formatCode == 0 {
-						// text format
-						valueBytes := conn.reader.ReadNBytes(int(valueLength))
-						value = string(valueBytes)
-					} else {
-						value = conn.reader.ReadNBytes(int(valueLength))
-					}
-					// need to know the column type to map the data returned by the server
-					data[fields[i].fieldName] = value
+				case fields[i].formatCode == 0:
+					// text format
+					data[fields[i].fieldName] = string(value)
+				default:
+					// need to know the column type to map the data returned by the server;
+					// copied since the value shares the reader's buffer
+					data[fields[i].fieldName] = append([]byte(nil), value...)
 				}
-				i++
 			}
-			rows = append(rows, data)
-		case byte(message.CommandComplete):
-			commandTag, _ := conn.reader.ReadCString()
-			fmt.Printf("[ReadQueryResponse] Recevied following command tag: %s\n", commandTag)
-		case byte(message.ParseComplete):
-			fmt.Println("Parse complete")
-		case byte(message.BindComplete):
-			fmt.Println("Bind complete")
-		case byte(message.ReadyForQuery):
-			status, err := message.ProcessReadyForQuery(conn.reader)
-			if err != nil {
-				fmt.Println("error processing ready for query:", err)
-				return nil
+			if req.stream != nil {
+				req.stream <- streamedRow{columns: current.Columns, values: data}
+			} else {
+				current.Rows = append(current.Rows, data)
 			}
-			conn.TransactionStatus = status
-			return rows
-		case byte(message.NoticeResponse):
-			for {
-				code, err := conn.reader.ReadByte()
-				if err != nil {
-					fmt.Println("error reading NoticeResponse field code:", err)
-					return nil
-				}
-				if code == 0 {
-					// end of message
-					break
-				}
-
-				value, err := conn.reader.ReadCString()
-				if err != nil {
-					fmt.Println("error reading NoticeResponse CString:", err)
-					return nil
+		case *message.CommandCompleteMessage:
+			conn.logger().Debug("command complete", slog.String("tag", msg.Tag))
+			commandTags = append(commandTags, ParseCommandTag(msg.Tag))
+			finishResultSet(commandTags[len(commandTags)-1])
+		case *message.EmptyQueryResponseMessage:
+			finishResultSet(ParseCommandTag(""))
+		case *message.CopyResponseMessage:
+			if msg.Type != message.CopyInResponse {
+				// COPY TO STDOUT, the data follows in CopyData messages
+				break
+			}
+			// The server is waiting for COPY data; errors from streaming take
+			// precedence over the ErrorResponse a CopyFail produces
+			if err := conn.streamCopyData(req); err != nil {
+				if pgErr, ok := err.(*PgError); ok {
+					copyErr = &StatementError{Index: len(resultSets), Err: pgErr}
+				} else {
+					copyErr = err
 				}
-
-				fmt.Printf("NoticeResponse field: %c => %s\n", code, value)
 			}
-		case byte(message.FunctionCallResponse):
-			fmt.Println("FunctionCallResponse - starting length read.")
-			funcResponseLength, err := conn.reader.ReadInt32()
-			if err != nil {
-				fmt.Println("error processing FunctionCallResponse: ", err)
-				return nil
+		case *message.CopyDataMessage:
+			// After a failure the rest of the data is drained and discarded
+			if copyErr == nil {
+				copyErr = conn.receiveCopyData(req, msg.Data)
 			}
-			fmt.Println("FunctionCallResponse - length value: ", funcResponseLength)
-			fmt.Println("FunctionCallResponse - starting function result read.")
-			x := conn.reader.ReadNBytes(int(funcResponseLength))
-			fmt.Println("FunctionCallResponse: ", string(x))
-		case byte(message.ErrorResponse):
-			errorFields := make(map[byte]string)
-
-			for {
-				// Read field type
-				fieldType, err := conn.reader.ReadByte()
-				if err != nil {
-					fmt.Println("error reading field type:", err)
-					return nil
-				}
+		case *message.NotificationResponseMessage:
+			conn.receiveNotification(msg)
+		case *message.PortalSuspendedMessage:
+			// Execute hit its row limit; the portal can be resumed with another Execute
+			suspended = true
+			finishResultSet(ParseCommandTag(""))
+		case *message.ReadyForQueryMessage:
+			conn.TransactionStatus = string(msg.TxStatus)
+			result := QueryResult{
+				Columns:     current.Columns,
+				Rows:        current.Rows,
+				ResultSets:  resultSets,
+				Suspended:   suspended,
+				CommandTags: commandTags,
+				paramOIDs:   paramOIDs,
+				fields:      described,
+				err:         serverErr,
+			}
+			if copyErr != nil {
+				result.err = copyErr
+			}
+			if protocolErr != nil {
+				result.err = protocolErr
+			}
+			if len(resultSets) > 0 {
+				last := resultSets[len(resultSets)-1]
+				result.Columns = last.Columns
+				result.Rows = last.Rows
+			}
+			if len(commandTags) > 0 {
+				result.CommandTag = commandTags[len(commandTags)-1]
+			}
+			return result
+		case *message.ParameterStatusMessage:
+			conn.receiveParameterStatus(msg)
+		case *message.ErrorFieldsMessage:
+			if msg.Type == message.NoticeResponse {
+				conn.receiveNotice(msg)
+				break
+			}
+			// The failed statement is the one after the last completed result set.
+			// Keep reading until ReadyForQuery so the next request starts on a clean stream
+			serverErr = &StatementError{Index: len(resultSets), Err: newPgError(msg.Fields)}
+			conn.logger().Debug("statement failed", slog.Any("error", serverErr))
+			current = newResultSet()
+		}
+		// ParseComplete, BindComplete, CloseComplete, CopyDone and
+		// FunctionCallResponse need nothing beyond the debug record; the
+		// CommandComplete after CopyDone carries the row count
+	}
+}
 
-				// Check for message terminator
-				if fieldType == 0 {
-					break
-				}
+// readBackendMessage reads the next message and passes it to the handler
+// registered for its type. The protocol's own messages come back decoded;
+// messages without a handler are skipped and, like those of user-registered
+// handlers, returned as nil.
+func (conn *PgConnection) readBackendMessage() (message.Message, error) {
+	msgType, length, err := conn.reader.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("error reading message: %w", err)
+	}
+	conn.logger().Debug("received message", slog.String("type", message.MessageType(msgType).String()))
+	conn.countRead(msgType, length)
+
+	conn.mu.RLock()
+	handler, ok := conn.handlers[msgType]
+	conn.mu.RUnlock()
+	if !ok {
+		conn.logger().Debug("skipping message without a handler", slog.String("type", string(msgType)))
+		return nil, nil
+	}
 
-				// Read field value
-				fieldValue, err := conn.reader.ReadCString()
-				if err != nil {
-					fmt.Println("error reading field value:", err)
-					return nil
-				}
+	value, err := handler(message.MessageType(msgType), conn.reader.Body())
+	if err != nil {
+		return nil, &messageError{msgType: message.MessageType(msgType), err: err}
+	}
+	msg, _ := value.(message.Message)
+	return msg, nil
+}
 
-				errorFields[fieldType] = fieldValue
-			}
+// messageError is returned for a message that was read whole but could not
+// be handled, so unlike an I/O error it leaves the stream in sync
+type messageError struct {
+	msgType message.MessageType
+	err     error
+}
 
-			// Log the complete error
-			fmt.Printf("[ReadQueryResponse] PostgreSQL Error:\n")
-			fmt.Printf("Severity: %s\n", errorFields[ErrorSeverity])
-			fmt.Printf("Code: %s\n", errorFields[ErrorCode])
-			fmt.Printf("Message: %s\n", errorFields[ErrorMessage])
-			if detail, ok := errorFields[ErrorDetail]; ok {
-				fmt.Printf("Detail: %s\n", detail)
-			}
+func (e *messageError) Error() string {
+	return fmt.Sprintf("error handling %s message: %v", e.msgType, e.err)
+}
 
-			return nil
+func (e *messageError) Unwrap() error {
+	return e.err
+}
+
+func columnNames(fields []RowDescription) []string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.fieldName
+	}
+	return names
+}
+
+// RowsAffected sums the rows changed by INSERT, UPDATE, DELETE and MERGE
+// statements, or returns -1 if none ran. Rows returned by SELECT, FETCH or
+// COPY do not count, as in ADO.NET.
+func (result *QueryResult) RowsAffected() int64 {
+	total := int64(-1)
+	for _, tag := range result.CommandTags {
+		if !tag.modifiesRows() {
+			continue
+		}
+		if total < 0 {
+			total = 0
 		}
+		total += tag.RowsAffected
+	}
+	return total
+}
+
+func newResultSet() ResultSet {
+	return ResultSet{
+		Columns:    make([]string, 0),
+		Rows:       make([]map[string]any, 0),
+		CommandTag: ParseCommandTag(""),
 	}
 }
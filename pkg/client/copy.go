@@ -0,0 +1,428 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+const copyChunkSize = 64 * 1024
+
+// While streaming COPY data the socket is checked for an early error every
+// copyPollInterval, waiting at most copyPollTimeout each time
+const (
+	copyPollInterval = 100 * time.Millisecond
+	copyPollTimeout  = time.Millisecond
+)
+
+// CopyFromSource supplies rows for CopyFromRows
+type CopyFromSource interface {
+	// Next advances to the next row and reports whether there is one
+	Next() bool
+	Values() ([]any, error)
+	Err() error
+}
+
+type sliceCopyFromSource struct {
+	rows  [][]any
+	index int
+}
+
+// CopyFromSlice returns a CopyFromSource over in-memory rows
+func CopyFromSlice(rows [][]any) CopyFromSource {
+	return &sliceCopyFromSource{rows: rows, index: -1}
+}
+
+func (source *sliceCopyFromSource) Next() bool {
+	source.index++
+	return source.index < len(source.rows)
+}
+
+func (source *sliceCopyFromSource) Values() ([]any, error) {
+	return source.rows[source.index], nil
+}
+
+func (source *sliceCopyFromSource) Err() error {
+	return nil
+}
+
+// CopyFrom runs a COPY ... FROM STDIN statement and streams source to the
+// server as is, so its contents must match the format named in the statement
+// (text, CSV or binary). It returns the number of rows copied.
+func (conn *PgConnection) CopyFrom(ctx context.Context, sql string, source io.Reader) (int64, error) {
+	resultChan := make(chan QueryResult, 1)
+	req := QueryRequest{
+		kind:       requestCopyIn,
+		query:      sql,
+		copySource: source,
+		ctx:        ctx,
+		result:     resultChan,
+	}
+
+	if err := conn.enqueue(ctx, req); err != nil {
+		return 0, err
+	}
+
+	// Cancellation is handled while streaming, so always wait for the result
+	result := <-resultChan
+	if result.err != nil {
+		return 0, result.err
+	}
+	return result.CommandTag.RowsAffected, nil
+}
+
+// CopyFromRows copies rows into the given columns of table using the binary
+// COPY format. Values are encoded according to the column types, which are
+// looked up first. A schema-qualified table may be given as "schema.table".
+func (conn *PgConnection) CopyFromRows(ctx context.Context, table string, columns []string, source CopyFromSource) (int64, error) {
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = quoteIdentifier(column)
+	}
+	columnList := strings.Join(quotedColumns, ", ")
+	quotedTable := quoteQualifiedIdentifier(table)
+
+	description, err := conn.Describe(ctx, fmt.Sprintf("SELECT %s FROM %s", columnList, quotedTable))
+	if err != nil {
+		return 0, fmt.Errorf("error describing copy target: %w", err)
+	}
+	oids := make([]Oid, len(description.Columns))
+	for i, column := range description.Columns {
+		oids[i] = column.DataType
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(encodeBinaryCopy(writer, oids, source))
+	}()
+	// Unblocks the encoder if the copy stops before reading everything
+	defer reader.Close()
+
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN (FORMAT binary)", quotedTable, columnList)
+	return conn.CopyFrom(ctx, sql, reader)
+}
+
+// encodeBinaryCopy writes the rows of source in the PGCOPY binary format
+func encodeBinaryCopy(w io.Writer, oids []Oid, source CopyFromSource) error {
+	copyWriter := message.NewCopyBinaryWriter(w)
+	if err := copyWriter.WriteHeader(); err != nil {
+		return err
+	}
+
+	row := 0
+	for source.Next() {
+		row++
+		values, err := source.Values()
+		if err != nil {
+			return fmt.Errorf("error reading row %d: %w", row, err)
+		}
+		if len(values) != len(oids) {
+			return fmt.Errorf("row %d has %d values, expected %d", row, len(values), len(oids))
+		}
+
+		fields := make([][]byte, len(values))
+		for i, value := range values {
+			fields[i], err = encodeBinaryValue(oids[i], value)
+			if err != nil {
+				return fmt.Errorf("row %d, column %d: %w", row, i+1, err)
+			}
+		}
+		if err := copyWriter.WriteRow(fields); err != nil {
+			return err
+		}
+	}
+	if err := source.Err(); err != nil {
+		return err
+	}
+
+	return copyWriter.WriteTrailer()
+}
+
+// streamCopyData sends the request's copy source as CopyData messages and
+// finishes with CopyDone, or with CopyFail when the source, the context or
+// the server reports an error
+func (conn *PgConnection) streamCopyData(req QueryRequest) error {
+	if req.copySource == nil {
+		conn.sendCopyFail("no copy source was provided")
+		return fmt.Errorf("COPY FROM STDIN requires CopyFrom")
+	}
+
+	ctx := req.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	chunk := make([]byte, copyChunkSize)
+	lastPoll := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			conn.sendCopyFail(err.Error())
+			return err
+		}
+
+		// The server reports bad data as soon as it sees it, stop sending early
+		if time.Since(lastPoll) >= copyPollInterval {
+			lastPoll = time.Now()
+			if pgErr := conn.pollCopyError(); pgErr != nil {
+				conn.sendCopyFail(pgErr.Message)
+				return pgErr
+			}
+		}
+
+		n, readErr := req.copySource.Read(chunk)
+		if n > 0 {
+			if err := conn.sendCopyData(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return conn.sendCopyDone()
+		}
+		if readErr != nil {
+			conn.sendCopyFail(readErr.Error())
+			return fmt.Errorf("error reading copy source: %w", readErr)
+		}
+	}
+}
+
+// pollCopyError checks, without blocking, whether the server has sent an
+// ErrorResponse while COPY data is still being streamed
+func (conn *PgConnection) pollCopyError() *PgError {
+	netConn := conn.client.conn
+	// A deadline already in the past fails without looking at the socket
+	netConn.SetReadDeadline(time.Now().Add(copyPollTimeout))
+	err := conn.reader.WaitMessage()
+	netConn.SetReadDeadline(time.Time{})
+	if err != nil {
+		// Nothing pending
+		return nil
+	}
+
+	msg, err := conn.readBackendMessage()
+	if err != nil {
+		return nil
+	}
+	// Notices, notifications and parameter updates may arrive mid-copy too
+	if err, ok := conn.handleAsyncMessage(msg).(*PgError); ok {
+		return err
+	}
+	return nil
+}
+
+// CopyTo runs a COPY ... TO STDOUT statement and writes the data the server
+// sends to destination as is, in the format named in the statement (text, CSV
+// or binary). It returns the number of rows copied.
+func (conn *PgConnection) CopyTo(ctx context.Context, sql string, destination io.Writer) (int64, error) {
+	resultChan := make(chan QueryResult, 1)
+	req := QueryRequest{
+		kind:       requestCopyOut,
+		query:      sql,
+		copyTarget: destination,
+		ctx:        ctx,
+		result:     resultChan,
+	}
+
+	if err := conn.enqueue(ctx, req); err != nil {
+		return 0, err
+	}
+
+	// Cancellation is handled while receiving, so always wait for the result
+	result := <-resultChan
+	if result.err != nil {
+		return 0, result.err
+	}
+	return result.CommandTag.RowsAffected, nil
+}
+
+// CopyToRows exports the result of query in the binary COPY format and calls
+// fn with the values of each row, decoded according to the column types. The
+// values slice is reused between calls. Returning an error from fn stops the
+// export.
+func (conn *PgConnection) CopyToRows(ctx context.Context, query string, fn func(values []any) error) (int64, error) {
+	description, err := conn.Describe(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("error describing copy source: %w", err)
+	}
+	oids := make([]Oid, len(description.Columns))
+	for i, column := range description.Columns {
+		oids[i] = column.DataType
+	}
+
+	reader, writer := io.Pipe()
+	decodeErrs := make(chan error, 1)
+	go func() {
+		err := decodeBinaryCopy(reader, oids, fn)
+		// Fails the copy's writes so the export stops early
+		reader.CloseWithError(err)
+		decodeErrs <- err
+	}()
+
+	sql := fmt.Sprintf("COPY (%s) TO STDOUT (FORMAT binary)", query)
+	rows, err := conn.CopyTo(ctx, sql, writer)
+	writer.CloseWithError(err)
+	decodeErr := <-decodeErrs
+	if err != nil {
+		// A failing fn surfaces through the writes of the copy
+		if decodeErr != nil && errors.Is(err, decodeErr) {
+			return 0, decodeErr
+		}
+		return 0, err
+	}
+	if decodeErr != nil {
+		return 0, decodeErr
+	}
+	return rows, nil
+}
+
+func decodeBinaryCopy(r io.Reader, oids []Oid, fn func(values []any) error) error {
+	decoder := NewCopyBinaryDecoder(r, oids)
+	for decoder.Next() {
+		if err := fn(decoder.Values()); err != nil {
+			return err
+		}
+	}
+	return decoder.Err()
+}
+
+// CopyBinaryDecoder turns a PGCOPY binary stream into typed Go values using
+// the type OIDs of its columns
+type CopyBinaryDecoder struct {
+	reader *message.CopyBinaryReader
+	oids   []Oid
+	values []any
+	header bool
+	done   bool
+	err    error
+}
+
+func NewCopyBinaryDecoder(r io.Reader, oids []Oid) *CopyBinaryDecoder {
+	return &CopyBinaryDecoder{
+		reader: message.NewCopyBinaryReader(r),
+		oids:   oids,
+		values: make([]any, len(oids)),
+	}
+}
+
+// Next decodes the next row and reports whether there is one
+func (d *CopyBinaryDecoder) Next() bool {
+	if d.done {
+		return false
+	}
+	if !d.header {
+		d.header = true
+		if err := d.reader.ReadHeader(); err != nil {
+			return d.fail(err)
+		}
+	}
+
+	fields, err := d.reader.ReadRow()
+	if err == io.EOF {
+		d.done = true
+		return false
+	}
+	if err != nil {
+		return d.fail(err)
+	}
+	if len(fields) != len(d.oids) {
+		return d.fail(fmt.Errorf("row has %d fields, expected %d", len(fields), len(d.oids)))
+	}
+
+	for i, field := range fields {
+		d.values[i], err = decodeBinaryValue(d.oids[i], field)
+		if err != nil {
+			return d.fail(fmt.Errorf("column %d: %w", i+1, err))
+		}
+	}
+	return true
+}
+
+func (d *CopyBinaryDecoder) fail(err error) bool {
+	d.err = err
+	d.done = true
+	return false
+}
+
+// Values returns the current row; the slice is reused by Next
+func (d *CopyBinaryDecoder) Values() []any {
+	return d.values
+}
+
+func (d *CopyBinaryDecoder) Err() error {
+	return d.err
+}
+
+// receiveCopyData passes one CopyData message of a COPY TO STDOUT to the
+// request's target. When that fails or the context ends, the server is asked
+// to cancel the COPY.
+func (conn *PgConnection) receiveCopyData(req QueryRequest, data []byte) error {
+	if req.copyTarget == nil {
+		conn.sendCancelRequest()
+		return fmt.Errorf("COPY TO STDOUT requires CopyTo")
+	}
+	if req.ctx != nil {
+		if err := req.ctx.Err(); err != nil {
+			conn.sendCancelRequest()
+			return err
+		}
+	}
+	if _, err := req.copyTarget.Write(data); err != nil {
+		conn.sendCancelRequest()
+		return fmt.Errorf("error writing copy data: %w", err)
+	}
+	return nil
+}
+
+// sendCancelRequest asks the server, over a separate connection, to cancel
+// whatever this connection is running
+func (conn *PgConnection) sendCancelRequest() {
+	if conn.backendPID == 0 {
+		// The server sent no BackendKeyData, so there is nothing to cancel with
+		return
+	}
+	cancelConn, err := net.DialTimeout("tcp", conn.client.host+":"+conn.client.port, 5*time.Second)
+	if err != nil {
+		conn.logger().Warn("error sending cancel request", slog.Any("error", err))
+		return
+	}
+	defer cancelConn.Close()
+
+	msg := &message.CancelRequest{ProcessID: conn.backendPID, SecretKey: conn.secretKey}
+	cancelConn.Write(msg.Encode(nil))
+}
+
+func (conn *PgConnection) sendCopyData(data []byte) error {
+	if err := conn.writeMessages((&message.CopyDataMessage{Data: data}).Encode(nil)); err != nil {
+		return fmt.Errorf("error writing copy data: %w", err)
+	}
+	return nil
+}
+
+func (conn *PgConnection) sendCopyDone() error {
+	if err := conn.writeMessages((&message.CopyDoneMessage{}).Encode(nil)); err != nil {
+		return fmt.Errorf("error writing copy done: %w", err)
+	}
+	return nil
+}
+
+func (conn *PgConnection) sendCopyFail(reason string) {
+	conn.writeMessages((&message.CopyFailMessage{Reason: reason}).Encode(nil))
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteQualifiedIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,90 @@
+package client
+
+import "fmt"
+
+// PgDataReader iterates over rows as they arrive from the server. The reader
+// must be read to the end or closed before the connection runs other queries.
+type PgDataReader struct {
+	stream  chan streamedRow
+	result  chan QueryResult
+	columns []string
+	current map[string]any
+	final   *QueryResult
+}
+
+// Read advances to the next row and reports whether one was available
+func (reader *PgDataReader) Read() bool {
+	if reader.final != nil {
+		return false
+	}
+
+	row, ok := <-reader.stream
+	if !ok {
+		reader.finish()
+		return false
+	}
+	reader.columns = row.columns
+	reader.current = row.values
+	return true
+}
+
+func (reader *PgDataReader) Columns() []string {
+	return reader.columns
+}
+
+func (reader *PgDataReader) FieldCount() int {
+	return len(reader.columns)
+}
+
+// Get returns the value of the named column in the current row
+func (reader *PgDataReader) Get(name string) any {
+	return reader.current[name]
+}
+
+// GetValue returns the value of the column at the given ordinal in the current row
+func (reader *PgDataReader) GetValue(ordinal int) (any, error) {
+	if ordinal < 0 || ordinal >= len(reader.columns) {
+		return nil, fmt.Errorf("column ordinal %d out of range", ordinal)
+	}
+	return reader.current[reader.columns[ordinal]], nil
+}
+
+func (reader *PgDataReader) Row() map[string]any {
+	return reader.current
+}
+
+// RecordsAffected returns the rows changed by the command once all rows have
+// been read, or -1 if it is not known yet or the command changed none
+func (reader *PgDataReader) RecordsAffected() int64 {
+	if reader.final == nil {
+		return -1
+	}
+	return reader.final.RowsAffected()
+}
+
+// Err returns the error that ended the result, if any
+func (reader *PgDataReader) Err() error {
+	if reader.final == nil {
+		return nil
+	}
+	return reader.final.err
+}
+
+// Close discards any unread rows and returns the error that ended the result
+func (reader *PgDataReader) Close() error {
+	for reader.final == nil {
+		if _, ok := <-reader.stream; !ok {
+			reader.finish()
+		}
+	}
+	return reader.final.err
+}
+
+func (reader *PgDataReader) finish() {
+	result := <-reader.result
+	reader.final = &result
+	reader.current = nil
+	if len(reader.columns) == 0 {
+		reader.columns = result.Columns
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import "context"
+
+// ColumnDescription is the metadata of a single result column
+type ColumnDescription struct {
+	Name            string
+	TableOID        Oid   // 0 if the column is not a table column
+	AttributeNumber int16 // 0 if the column is not a table column
+	DataType        Oid
+	TypeSize        int16 // negative for variable-width types
+	TypeModifier    int32
+	Format          int16
+}
+
+// StatementDescription describes the parameters and result columns of a
+// statement. Columns is empty for statements that return no rows.
+type StatementDescription struct {
+	ParameterTypes []Oid
+	Columns        []ColumnDescription
+}
+
+// Describe asks the server for the parameter types and result columns of sql
+// without executing it
+func (conn *PgConnection) Describe(ctx context.Context, sql string) (*StatementDescription, error) {
+	resultChan := make(chan QueryResult, 1)
+	req := QueryRequest{
+		kind:   requestDescribe,
+		query:  sql,
+		result: resultChan,
+	}
+
+	if err := conn.enqueue(ctx, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return newStatementDescription(result.paramOIDs, result.fields), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newStatementDescription(paramOIDs []Oid, fields []RowDescription) *StatementDescription {
+	description := &StatementDescription{
+		ParameterTypes: make([]Oid, len(paramOIDs)),
+		Columns:        make([]ColumnDescription, len(fields)),
+	}
+	copy(description.ParameterTypes, paramOIDs)
+	for i, field := range fields {
+		description.Columns[i] = ColumnDescription{
+			Name:            field.fieldName,
+			TableOID:        Oid(field.tableObjectId),
+			AttributeNumber: field.attributeNumber,
+			DataType:        Oid(field.fieldDataTypeObjectId),
+			TypeSize:        field.dataTypeSize,
+			TypeModifier:    field.typeModifier,
+			Format:          field.formatCode,
+		}
+	}
+	return description
+}
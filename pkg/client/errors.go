@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PgError is an ErrorResponse returned by the server
+type PgError struct {
+	Severity string
+	Code     string
+	Message  string
+	Detail   string
+	Hint     string
+	Position string
+	Where    string
+	File     string
+	Line     string
+	Routine  string
+}
+
+func newPgError(fields map[byte]string) *PgError {
+	return &PgError{
+		Severity: fields[ErrorSeverity],
+		Code:     fields[ErrorCode],
+		Message:  fields[ErrorMessage],
+		Detail:   fields[ErrorDetail],
+		Hint:     fields[ErrorHint],
+		Position: fields[ErrorPosition],
+		Where:    fields[ErrorWhere],
+		File:     fields[ErrorFile],
+		Line:     fields[ErrorLine],
+		Routine:  fields[ErrorRoutine],
+	}
+}
+
+func (e *PgError) Error() string {
+	return fmt.Sprintf("%s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+// StatementError reports which statement of a multi-statement query failed
+type StatementError struct {
+	Index int // zero-based position of the failed statement
+	Err   *PgError
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d failed: %v", e.Index+1, e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// isServerError reports whether err came from an ErrorResponse, after which
+// the connection is still usable
+func isServerError(err error) bool {
+	var pgErr *PgError
+	return errors.As(err, &pgErr)
+}
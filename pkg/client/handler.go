@@ -0,0 +1,33 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+var ErrHandlerExists = errors.New("message type already has a handler")
+
+// RegisterHandler sets the handler for a backend message type the protocol
+// does not define, such as one sent by a server extension or proxy. The
+// handler is given the message body, which is only valid until it returns,
+// and runs on the goroutine that reads the connection, so it must not block
+// or send commands on the same connection. Its return value is ignored; an
+// error fails the request being read.
+func (conn *PgConnection) RegisterHandler(msgType byte, handler message.ResponseHandler) error {
+	if handler == nil {
+		return fmt.Errorf("nil handler for message type %q", msgType)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if _, ok := conn.handlers[msgType]; ok {
+		return fmt.Errorf("message type %q: %w", msgType, ErrHandlerExists)
+	}
+	// Only the protocol's own handlers produce messages the connection acts on
+	conn.handlers[msgType] = func(messageType message.MessageType, data []byte) (any, error) {
+		_, err := handler(messageType, data)
+		return nil, err
+	}
+	return nil
+}
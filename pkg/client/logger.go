@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// discardHandler drops every record; connections are silent unless a logger
+// is set
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// SetLogger sets the logger the connection writes to. Records carry the
+// host, database and, once connected, the backend pid. Passwords and
+// parameter values are never logged.
+func (conn *PgConnection) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = discardLogger
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.baseLogger = logger
+	conn.log = conn.connectionLogger()
+}
+
+func (conn *PgConnection) logger() *slog.Logger {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return conn.log
+}
+
+// connectionLogger adds the connection attributes to the base logger; the
+// caller holds conn.mu
+func (conn *PgConnection) connectionLogger() *slog.Logger {
+	logger := conn.baseLogger.With(
+		slog.String("host", conn.details.Host),
+		slog.String("database", conn.details.Database),
+	)
+	if conn.backendPID != 0 {
+		logger = logger.With(slog.Int("pid", int(conn.backendPID)))
+	}
+	return logger
+}
+
+// LogValue keeps the password out of logs
+func (details ConnectionDetails) LogValue() slog.Value {
+	password := ""
+	if details.Password != "" {
+		password = "[REDACTED]"
+	}
+	return slog.GroupValue(
+		slog.String("host", details.Host),
+		slog.String("port", details.Port),
+		slog.String("username", details.Username),
+		slog.String("password", password),
+		slog.String("database", details.Database),
+	)
+}
+
+// LogValue keeps parameter values out of logs
+func (param *PgParameter) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", param.Name),
+		slog.Any("type", param.DataType),
+		slog.String("value", "[REDACTED]"),
+	)
+}
+
+// SetWireTrace records every message exchanged with the server to trace.
+// It takes effect on the next Connect.
+func (conn *PgConnection) SetWireTrace(trace *message.WireTrace) {
+	conn.wireTrace = trace
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// Upper bounds, in seconds, of the query duration histogram buckets
+var durationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects counters and histograms for the connections it is set on
+// and serves them in the Prometheus text exposition format. One Metrics can be
+// shared by any number of connections.
+type Metrics struct {
+	mu              sync.Mutex
+	queries         map[string]uint64 // by event
+	errors          map[string]uint64 // by SQLSTATE class
+	bytesRead       map[string]uint64 // by message type
+	bytesWritten    map[string]uint64 // by message type
+	durations       map[string]*histogram
+	connectAttempts uint64
+	connectFailures uint64
+	queues          map[chan QueryRequest]struct{}
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		queries:      make(map[string]uint64),
+		errors:       make(map[string]uint64),
+		bytesRead:    make(map[string]uint64),
+		bytesWritten: make(map[string]uint64),
+		durations:    make(map[string]*histogram),
+		queues:       make(map[chan QueryRequest]struct{}),
+	}
+}
+
+// SetMetrics makes the connection report to metrics; nil stops reporting
+func (conn *PgConnection) SetMetrics(metrics *Metrics) {
+	conn.mu.Lock()
+	previous := conn.metrics
+	conn.metrics = metrics
+	conn.mu.Unlock()
+
+	if previous != nil {
+		previous.removeQueue(conn.queryQueue)
+	}
+	if metrics != nil {
+		metrics.addQueue(conn.queryQueue)
+	}
+}
+
+func (conn *PgConnection) currentMetrics() *Metrics {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return conn.metrics
+}
+
+func (m *Metrics) addQueue(queue chan QueryRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[queue] = struct{}{}
+}
+
+func (m *Metrics) removeQueue(queue chan QueryRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, queue)
+}
+
+func (m *Metrics) observeConnect(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectAttempts++
+	if err != nil {
+		m.connectFailures++
+	}
+}
+
+// observeQuery records one request; every non-nil error counts separately
+func (m *Metrics) observeQuery(event TraceEvent, duration time.Duration, errs ...error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	label := event.String()
+	m.queries[label]++
+	for _, err := range errs {
+		if err != nil {
+			m.errors[errorClass(err)]++
+		}
+	}
+
+	h, ok := m.durations[label]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+		m.durations[label] = h
+	}
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(durationBuckets, seconds)
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+}
+
+func (m *Metrics) observeRead(msgType byte, length int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytesRead[message.MessageType(msgType).String()] += uint64(length) + 1
+}
+
+// observeWritten counts the bytes of every message in b, which holds whole
+// frontend messages
+func (m *Metrics) observeWritten(b []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(b) >= 5 {
+		length := int(binary.BigEndian.Uint32(b[1:5]))
+		if length < 4 || length+1 > len(b) {
+			break
+		}
+		m.bytesWritten[message.MessageType(b[0]).FrontendString()] += uint64(length) + 1
+		b = b[length+1:]
+	}
+}
+
+// observeWrittenMessage counts a message that has no type byte
+func (m *Metrics) observeWrittenMessage(name string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytesWritten[name] += uint64(n)
+}
+
+// errorClass is the SQLSTATE class of a server error, or "client" for errors
+// raised without a server response such as I/O failures
+func errorClass(err error) string {
+	var pgErr *PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) >= 2 {
+		return pgErr.Code[:2]
+	}
+	return "client"
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	m.mu.Lock()
+	writeCounter(out, "pgclient_queries_total", "Queries executed.", "event", m.queries)
+	writeCounter(out, "pgclient_query_errors_total", "Queries that failed, by SQLSTATE class.", "class", m.errors)
+	writeCounter(out, "pgclient_read_bytes_total", "Bytes read from the server, by message type.", "message", m.bytesRead)
+	writeCounter(out, "pgclient_written_bytes_total", "Bytes written to the server, by message type.", "message", m.bytesWritten)
+	writeHistogram(out, "pgclient_query_duration_seconds", "Time from a connection picking a query up until its result is ready.", "event", m.durations)
+
+	fmt.Fprintln(out, "# HELP pgclient_connect_attempts_total Connection attempts.")
+	fmt.Fprintln(out, "# TYPE pgclient_connect_attempts_total counter")
+	fmt.Fprintf(out, "pgclient_connect_attempts_total %d\n", m.connectAttempts)
+	fmt.Fprintln(out, "# HELP pgclient_connect_failures_total Connection attempts that failed.")
+	fmt.Fprintln(out, "# TYPE pgclient_connect_failures_total counter")
+	fmt.Fprintf(out, "pgclient_connect_failures_total %d\n", m.connectFailures)
+
+	depth := 0
+	for queue := range m.queues {
+		depth += len(queue)
+	}
+	m.mu.Unlock()
+
+	fmt.Fprintln(out, "# HELP pgclient_queue_depth Requests waiting in query queues.")
+	fmt.Fprintln(out, "# TYPE pgclient_queue_depth gauge")
+	fmt.Fprintf(out, "pgclient_queue_depth %d\n", depth)
+
+	return out.Flush()
+}
+
+func writeCounter(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escapeLabelValue(key), values[key])
+	}
+}
+
+func writeHistogram(w io.Writer, name, help, label string, values map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, key := range sortedKeys(values) {
+		h := values[key]
+		value := escapeLabelValue(key)
+		cumulative := uint64(0)
+		for i, bound := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s=\"%s\",le=\"%g\"} %d\n", name, label, value, bound, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=\"%s\",le=\"+Inf\"} %d\n", name, label, value, h.count)
+		fmt.Fprintf(w, "%s_sum{%s=\"%s\"} %g\n", name, label, value, h.sum)
+		fmt.Fprintf(w, "%s_count{%s=\"%s\"} %d\n", name, label, value, h.count)
+	}
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// writeMessages writes whole frontend messages to the server
+func (conn *PgConnection) writeMessages(b []byte) error {
+	if metrics := conn.currentMetrics(); metrics != nil {
+		metrics.observeWritten(b)
+	}
+	_, err := conn.writer.Write(b)
+	return err
+}
+
+// countRead records a message read from the server
+func (conn *PgConnection) countRead(msgType byte, length int32) {
+	if metrics := conn.currentMetrics(); metrics != nil {
+		metrics.observeRead(msgType, length)
+	}
+}
+
+// observeRequest records a finished request picked up at req.started. The
+// commands of a non-transactional batch fail on their own, so each failed
+// command counts as an error.
+func (conn *PgConnection) observeRequest(req QueryRequest, result QueryResult) {
+	metrics := conn.currentMetrics()
+	if metrics == nil || req.started.IsZero() {
+		return
+	}
+	errs := []error{result.err}
+	for _, command := range result.batch {
+		errs = append(errs, command.err)
+	}
+	metrics.observeQuery(requestEvent(req), time.Since(req.started), errs...)
+}
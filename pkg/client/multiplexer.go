@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+const defaultMultiplexerQueueSize = 1000
+
+var (
+	ErrMultiplexedTransaction = errors.New("transactions are not supported on multiplexed connections, the transaction was rolled back")
+	ErrMultiplexedStatement   = errors.New("named statements and portals are not supported on multiplexed connections")
+	ErrMultiplexerClosed      = errors.New("multiplexer is closed")
+)
+
+// sharedQueue tracks whether the queue of a multiplexer was closed. The
+// channel itself stays open since a send on a closed channel panics.
+type sharedQueue struct {
+	mu   sync.RWMutex
+	done chan struct{}
+	once sync.Once
+}
+
+func (shared *sharedQueue) send(ctx context.Context, queue chan QueryRequest, req QueryRequest) error {
+	// Close waits for the lock, so nothing is queued once it drains the queue
+	shared.mu.RLock()
+	defer shared.mu.RUnlock()
+	select {
+	case <-shared.done:
+		return ErrMultiplexerClosed
+	default:
+	}
+
+	select {
+	case queue <- req:
+		return nil
+	case <-shared.done:
+		return ErrMultiplexerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueClosed is closed once the multiplexer sharing the queue is closed; it
+// is nil, and never ready, for a connection of its own
+func (conn *PgConnection) queueClosed() <-chan struct{} {
+	if conn.sharedQueue == nil {
+		return nil
+	}
+	return conn.sharedQueue.done
+}
+
+// close stops new requests and fails the ones still queued
+func (shared *sharedQueue) close(queue chan QueryRequest) {
+	shared.once.Do(func() { close(shared.done) })
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	for {
+		select {
+		case req := <-queue:
+			if req.stream != nil {
+				close(req.stream)
+			}
+			req.result <- QueryResult{err: ErrMultiplexerClosed}
+		default:
+			return
+		}
+	}
+}
+
+// PgMultiplexer lets many goroutines share a small set of physical
+// connections. Commands go to one queue that every connection drains and
+// pipelines, so whichever connection is free runs the next command. Only
+// non-transactional commands are supported since consecutive commands may run
+// on different connections.
+type PgMultiplexer struct {
+	queue       chan QueryRequest
+	shared      *sharedQueue
+	front       *PgConnection // never connected, only routes commands to the queue
+	connections []*PgConnection
+}
+
+func NewPgMultiplexer(connectionString string, connections int) *PgMultiplexer {
+	if connections <= 0 {
+		connections = 1
+	}
+
+	details := parseConnectionString(connectionString)
+	if details.Pipeline == "" {
+		details.Pipeline = "true"
+	}
+
+	mux := &PgMultiplexer{
+		queue:       make(chan QueryRequest, defaultMultiplexerQueueSize),
+		shared:      &sharedQueue{done: make(chan struct{})},
+		connections: make([]*PgConnection, connections),
+	}
+	mux.front = newPgConnection(details, mux.queue)
+	mux.front.multiplexed = true
+	mux.front.sharedQueue = mux.shared
+	for i := range mux.connections {
+		conn := newPgConnection(details, mux.queue)
+		conn.multiplexed = true
+		conn.sharedQueue = mux.shared
+		mux.connections[i] = conn
+	}
+	return mux
+}
+
+// Open connects every physical connection and starts draining the queue.
+// Commands queued before Open wait until a connection is ready. If any
+// connection fails, the ones already open are closed again.
+func (mux *PgMultiplexer) Open() error {
+	for i, conn := range mux.connections {
+		if err := conn.Connect(); err != nil {
+			for _, opened := range mux.connections[:i] {
+				opened.Close()
+			}
+			return fmt.Errorf("error opening multiplexed connection %d: %w", i+1, err)
+		}
+	}
+	for _, conn := range mux.connections {
+		go conn.ProcessQueries()
+	}
+	return nil
+}
+
+// Close fails queued commands and any sent afterwards with
+// ErrMultiplexerClosed, then closes every physical connection
+func (mux *PgMultiplexer) Close() error {
+	mux.shared.close(mux.queue)
+	var closeErr error
+	for _, conn := range mux.connections {
+		if err := conn.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+func (mux *PgMultiplexer) NewCommand(commandText string) *PgCommand {
+	return NewPgCommand(commandText, mux.front)
+}
+
+func (mux *PgMultiplexer) NewBatch() *PgBatch {
+	return NewPgBatch(mux.front)
+}
+
+func (mux *PgMultiplexer) Describe(ctx context.Context, sql string) (*StatementDescription, error) {
+	return mux.front.Describe(ctx, sql)
+}
+
+// QueueDepth returns the number of commands waiting for a connection
+func (mux *PgMultiplexer) QueueDepth() int {
+	return len(mux.queue)
+}
+
+// abortMultiplexedTransaction rolls back a transaction left open by a
+// multiplexed command so the next command on this connection starts clean
+func (conn *PgConnection) abortMultiplexedTransaction() error {
+	result := conn.roundTrip(QueryRequest{query: "ROLLBACK"})
+	if result.err != nil {
+		return fmt.Errorf("%w: %w", ErrMultiplexedTransaction, result.err)
+	}
+	return ErrMultiplexedTransaction
+}
+
+// SetLogger sets the logger of every physical connection
+func (mux *PgMultiplexer) SetLogger(logger *slog.Logger) {
+	mux.front.SetLogger(logger)
+	for _, conn := range mux.connections {
+		conn.SetLogger(logger)
+	}
+}
+
+// RegisterHandler sets the handler for a backend message type on every
+// physical connection
+func (mux *PgMultiplexer) RegisterHandler(msgType byte, handler message.ResponseHandler) error {
+	if err := mux.front.RegisterHandler(msgType, handler); err != nil {
+		return err
+	}
+	for _, conn := range mux.connections {
+		if err := conn.RegisterHandler(msgType, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTracer sets the tracer of every physical connection
+func (mux *PgMultiplexer) SetTracer(tracer Tracer) {
+	mux.front.SetTracer(tracer)
+	for _, conn := range mux.connections {
+		conn.SetTracer(tracer)
+	}
+}
+
+// SetMetrics makes every physical connection report to metrics
+func (mux *PgMultiplexer) SetMetrics(metrics *Metrics) {
+	mux.front.SetMetrics(metrics)
+	for _, conn := range mux.connections {
+		conn.SetMetrics(metrics)
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// Notice is a NoticeResponse: a warning or informational message that does
+// not fail the statement. It has the same fields as an error.
+type Notice PgError
+
+func (n *Notice) String() string {
+	return fmt.Sprintf("%s: %s (SQLSTATE %s)", n.Severity, n.Message, n.Code)
+}
+
+// OnNotice sets the function called for every notice the server sends.
+// Hooks run on the goroutine that reads the connection, so they must not
+// block or send commands on the same connection.
+func (conn *PgConnection) OnNotice(handler func(notice *Notice)) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.noticeHandler = handler
+}
+
+// OnParameterStatus sets the function called when the server reports a new
+// value for a run-time parameter, e.g. after SET TimeZone
+func (conn *PgConnection) OnParameterStatus(handler func(name, value string)) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.parameterStatusHandler = handler
+}
+
+// ParameterStatus returns the last value the server reported for a run-time
+// parameter such as server_version or TimeZone
+func (conn *PgConnection) ParameterStatus(name string) (string, bool) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	value, ok := conn.connParams[name]
+	return value, ok
+}
+
+// ParameterStatuses returns a copy of every run-time parameter the server
+// has reported
+func (conn *PgConnection) ParameterStatuses() map[string]string {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	params := make(map[string]string, len(conn.connParams))
+	for name, value := range conn.connParams {
+		params[name] = value
+	}
+	return params
+}
+
+// receiveNotice passes a NoticeResponse to the hook
+func (conn *PgConnection) receiveNotice(msg *message.ErrorFieldsMessage) {
+	notice := (*Notice)(newPgError(msg.Fields))
+	conn.logger().Info("notice", slog.String("severity", notice.Severity), slog.String("code", notice.Code), slog.String("message", notice.Message))
+
+	conn.mu.RLock()
+	handler := conn.noticeHandler
+	conn.mu.RUnlock()
+	if handler != nil {
+		handler(notice)
+	}
+}
+
+// receiveParameterStatus records the new value of a server parameter and
+// passes it to the hook
+func (conn *PgConnection) receiveParameterStatus(msg *message.ParameterStatusMessage) {
+	name, value := msg.Name, msg.Value
+
+	conn.mu.Lock()
+	conn.connParams[name] = value
+	handler := conn.parameterStatusHandler
+	conn.mu.Unlock()
+	if handler != nil {
+		handler(name, value)
+	}
+}
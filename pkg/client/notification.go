@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// Notifications beyond this many unread ones are dropped rather than
+// stalling the connection
+const notificationBufferSize = 1000
+
+var ErrMultiplexedListen = errors.New("LISTEN is not supported on multiplexed connections")
+
+// Notification is a NOTIFY received on a channel the connection listens on
+type Notification struct {
+	PID     int32 // backend process that sent the notification
+	Channel string
+	Payload string
+}
+
+// Listen subscribes the connection to channel. Once listening, notifications
+// are also picked up while the connection is idle.
+func (conn *PgConnection) Listen(ctx context.Context, channel string) error {
+	if conn.multiplexed {
+		return ErrMultiplexedListen
+	}
+	// Set on the connection goroutine so the idle reader starts right after
+	// LISTEN succeeds, before the next request is awaited
+	listen := func() { conn.listening.Store(true) }
+	if err := conn.run(ctx, "LISTEN "+quoteIdentifier(channel), listen); err != nil {
+		return fmt.Errorf("error listening on %s: %w", channel, err)
+	}
+	return nil
+}
+
+// Unlisten unsubscribes the connection from channel, or from every channel
+// when channel is "*"
+func (conn *PgConnection) Unlisten(ctx context.Context, channel string) error {
+	target := "*"
+	// Other channels may still be listened on unless every one is dropped
+	var unlisten func()
+	if channel == "*" {
+		unlisten = func() { conn.listening.Store(false) }
+	} else {
+		target = quoteIdentifier(channel)
+	}
+	if err := conn.run(ctx, "UNLISTEN "+target, unlisten); err != nil {
+		return fmt.Errorf("error unlistening from %s: %w", channel, err)
+	}
+	return nil
+}
+
+// Notifications returns the channel notifications are delivered on
+func (conn *PgConnection) Notifications() <-chan Notification {
+	return conn.notifications
+}
+
+// WaitForNotification blocks until a notification arrives or ctx is done
+func (conn *PgConnection) WaitForNotification(ctx context.Context) (*Notification, error) {
+	select {
+	case notification := <-conn.notifications:
+		return &notification, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run executes a statement without parameters through the query queue;
+// onSuccess, if set, runs on the connection goroutine once it succeeds
+func (conn *PgConnection) run(ctx context.Context, sql string, onSuccess func()) error {
+	resultChan := make(chan QueryResult, 1)
+	if err := conn.enqueue(ctx, QueryRequest{query: sql, result: resultChan, onSuccess: onSuccess}); err != nil {
+		return err
+	}
+
+	select {
+	case result := <-resultChan:
+		return result.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receiveNotification delivers a NotificationResponse
+func (conn *PgConnection) receiveNotification(msg *message.NotificationResponseMessage) {
+	select {
+	case conn.notifications <- Notification{PID: msg.ProcessID, Channel: msg.Channel, Payload: msg.Payload}:
+	default:
+		conn.logger().Warn("notification buffer is full, dropping notification", slog.String("channel", msg.Channel))
+	}
+}
+
+// readAsyncMessage reads a message the server sent while no request was
+// running
+func (conn *PgConnection) readAsyncMessage() error {
+	msg, err := conn.readBackendMessage()
+	if err != nil {
+		return err
+	}
+	return conn.handleAsyncMessage(msg)
+}
+
+// handleAsyncMessage handles a message that may arrive at any time
+func (conn *PgConnection) handleAsyncMessage(msg message.Message) error {
+	switch msg := msg.(type) {
+	case *message.NotificationResponseMessage:
+		conn.receiveNotification(msg)
+	case *message.ParameterStatusMessage:
+		conn.receiveParameterStatus(msg)
+	case *message.ErrorFieldsMessage:
+		if msg.Type == message.NoticeResponse {
+			conn.receiveNotice(msg)
+			break
+		}
+		// Only sent while idle when the server is terminating the session
+		return newPgError(msg.Fields)
+	}
+	return nil
+}
+
+// nextRequest waits for the next request. While the connection listens for
+// notifications the socket is read in the meantime, so they arrive without
+// running a query.
+func (conn *PgConnection) nextRequest() (QueryRequest, bool) {
+	if !conn.listening.Load() || conn.idleErr != nil {
+		return conn.waitRequest()
+	}
+
+	select {
+	case req, ok := <-conn.queryQueue:
+		return req, ok
+	default:
+	}
+
+	idle := &idleReader{conn: conn, done: make(chan error, 1)}
+	go idle.run()
+
+	select {
+	case req, ok := <-conn.queryQueue:
+		conn.idleErr = idle.stop()
+		return req, ok
+	case <-conn.queueClosed():
+		conn.idleErr = idle.stop()
+		return QueryRequest{}, false
+	case err := <-idle.done:
+		conn.logger().Warn("stopped reading idle connection", slog.Any("error", err))
+		conn.idleErr = err
+		return conn.waitRequest()
+	}
+}
+
+// waitRequest waits for the next request without reading the socket
+func (conn *PgConnection) waitRequest() (QueryRequest, bool) {
+	select {
+	case req, ok := <-conn.queryQueue:
+		return req, ok
+	case <-conn.queueClosed():
+		return QueryRequest{}, false
+	}
+}
+
+// idleReader reads asynchronous messages until stopped. Stopping interrupts
+// a read that is waiting for a message but never one that is half done.
+type idleReader struct {
+	conn     *PgConnection
+	mu       sync.Mutex
+	stopping bool
+	busy     bool // a message is being read
+	done     chan error
+}
+
+func (idle *idleReader) run() {
+	idle.done <- idle.read()
+}
+
+func (idle *idleReader) read() error {
+	netConn := idle.conn.client.conn
+	for {
+		if err := idle.conn.reader.WaitMessage(); err != nil {
+			idle.mu.Lock()
+			stopping := idle.stopping
+			idle.mu.Unlock()
+			if stopping {
+				return nil
+			}
+			return fmt.Errorf("error reading idle connection: %w", err)
+		}
+
+		idle.mu.Lock()
+		idle.busy = true
+		netConn.SetReadDeadline(time.Time{})
+		idle.mu.Unlock()
+
+		if err := idle.conn.readAsyncMessage(); err != nil {
+			return err
+		}
+
+		idle.mu.Lock()
+		idle.busy = false
+		stopping := idle.stopping
+		idle.mu.Unlock()
+		if stopping {
+			return nil
+		}
+	}
+}
+
+// stop interrupts the reader, waits for it and returns its error
+func (idle *idleReader) stop() error {
+	netConn := idle.conn.client.conn
+
+	idle.mu.Lock()
+	idle.stopping = true
+	if !idle.busy {
+		netConn.SetReadDeadline(time.Now())
+	}
+	idle.mu.Unlock()
+
+	err := <-idle.done
+	netConn.SetReadDeadline(time.Time{})
+	return err
+}
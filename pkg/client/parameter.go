@@ -0,0 +1,178 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ParameterDirection int
+
+const (
+	ParameterIn ParameterDirection = iota
+	ParameterOut
+	ParameterInOut
+)
+
+const (
+	TextFormat   int16 = 0
+	BinaryFormat int16 = 1
+)
+
+// PgParameter is a single command parameter. Out and InOut parameters are
+// filled from the row returned by a CALL once the command has executed.
+type PgParameter struct {
+	Name      string
+	Value     any
+	DataType  Oid   // UnspecifiedOID lets the server infer the type
+	Format    int16 // TextFormat, or BinaryFormat for pre-encoded []byte values
+	Direction ParameterDirection
+	Size      int // maximum length of string values, 0 for no limit
+	Precision int // total digits of numeric values, informational only
+	Scale     int // digits after the decimal point used when sending floats
+}
+
+func NewPgParameter(name string, value any) *PgParameter {
+	return &PgParameter{
+		Name:  strings.TrimLeft(name, ":@"),
+		Value: value,
+	}
+}
+
+// encode returns the wire representation of the value, or nil for NULL
+func (param *PgParameter) encode() ([]byte, error) {
+	if param.Direction == ParameterOut || param.Value == nil {
+		return nil, nil
+	}
+
+	if param.Format == BinaryFormat {
+		value, ok := param.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s: binary format requires a []byte value, got %T", param.Name, param.Value)
+		}
+		return value, nil
+	}
+
+	var text string
+	switch value := param.Value.(type) {
+	case string:
+		text = value
+	case []byte:
+		// bytea hex format
+		text = `\x` + hex.EncodeToString(value)
+	case bool:
+		text = strconv.FormatBool(value)
+	case time.Time:
+		text = value.Format("2006-01-02 15:04:05.999999Z07:00")
+	case float32:
+		text = param.formatFloat(float64(value), 32)
+	case float64:
+		text = param.formatFloat(value, 64)
+	case fmt.Stringer:
+		text = value.String()
+	default:
+		text = fmt.Sprintf("%v", value)
+	}
+
+	if param.Size > 0 {
+		if runes := []rune(text); len(runes) > param.Size {
+			text = string(runes[:param.Size])
+		}
+	}
+	return []byte(text), nil
+}
+
+func (param *PgParameter) formatFloat(value float64, bitSize int) string {
+	if param.Scale > 0 {
+		return strconv.FormatFloat(value, 'f', param.Scale, bitSize)
+	}
+	return strconv.FormatFloat(value, 'g', -1, bitSize)
+}
+
+func parameterOIDs(params []*PgParameter) []Oid {
+	oids := make([]Oid, len(params))
+	for i, param := range params {
+		oids[i] = param.DataType
+	}
+	return oids
+}
+
+// PgParameterCollection holds the parameters of a command in the order they
+// were added; names are unique
+type PgParameterCollection struct {
+	items []*PgParameter
+	index map[string]int
+}
+
+func NewPgParameterCollection() *PgParameterCollection {
+	return &PgParameterCollection{
+		items: make([]*PgParameter, 0),
+		index: make(map[string]int),
+	}
+}
+
+// Add appends the parameter, replacing an existing one with the same name
+func (params *PgParameterCollection) Add(param *PgParameter) *PgParameter {
+	param.Name = strings.TrimLeft(param.Name, ":@")
+	if i, ok := params.index[param.Name]; ok {
+		params.items[i] = param
+		return param
+	}
+	params.index[param.Name] = len(params.items)
+	params.items = append(params.items, param)
+	return param
+}
+
+func (params *PgParameterCollection) AddWithValue(name string, value any) *PgParameter {
+	if param, ok := params.Get(name); ok {
+		param.Value = value
+		return param
+	}
+	return params.Add(NewPgParameter(name, value))
+}
+
+func (params *PgParameterCollection) Get(name string) (*PgParameter, bool) {
+	i, ok := params.index[strings.TrimLeft(name, ":@")]
+	if !ok {
+		return nil, false
+	}
+	return params.items[i], true
+}
+
+func (params *PgParameterCollection) Contains(name string) bool {
+	_, ok := params.Get(name)
+	return ok
+}
+
+func (params *PgParameterCollection) Remove(name string) bool {
+	i, ok := params.index[strings.TrimLeft(name, ":@")]
+	if !ok {
+		return false
+	}
+	params.items = append(params.items[:i], params.items[i+1:]...)
+	params.reindex()
+	return true
+}
+
+func (params *PgParameterCollection) Clear() {
+	params.items = make([]*PgParameter, 0)
+	params.index = make(map[string]int)
+}
+
+func (params *PgParameterCollection) Len() int {
+	return len(params.items)
+}
+
+// All returns the parameters in the order they were added
+func (params *PgParameterCollection) All() []*PgParameter {
+	return append([]*PgParameter(nil), params.items...)
+}
+
+func (params *PgParameterCollection) reindex() {
+	params.index = make(map[string]int, len(params.items))
+	for i, param := range params.items {
+		params.index[param.Name] = i
+	}
+}
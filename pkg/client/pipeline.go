@@ -0,0 +1,162 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+const defaultPipelineDepth = 32
+
+// pipelineEntry tracks one request of a pipeline from sending to completion
+type pipelineEntry struct {
+	original  QueryRequest // as queued, used to retry a stale cached plan
+	req       QueryRequest // as sent, possibly rewritten by the statement cache
+	statement *preparedStatement
+	cacheHit  bool
+	result    QueryResult
+	sent      bool
+}
+
+func parsePipelineDepth(pipeline string, depth string) int {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(pipeline))
+	if err != nil || !enabled {
+		return 0
+	}
+	value, err := strconv.Atoi(depth)
+	if err != nil || value <= 0 {
+		return defaultPipelineDepth
+	}
+	return value
+}
+
+// canPipeline reports whether the request is a single extended-protocol
+// statement ending in its own Sync. Simple queries, portals and other
+// requests run on their own.
+func canPipeline(req QueryRequest) bool {
+	switch req.kind {
+	case requestExecutePrepared:
+		return true
+	case requestQuery:
+		return len(req.params) > 0
+	default:
+		return false
+	}
+}
+
+// runPipeline writes the first request together with any other queued
+// pipelineable requests in one go, then reads the results back in order.
+// Every request ends with its own Sync, so an error only aborts the request
+// it belongs to. The first queued request that cannot be pipelined is
+// returned so the caller can run it next.
+func (conn *PgConnection) runPipeline(first QueryRequest) *QueryRequest {
+	batch := []QueryRequest{first}
+	var leftover *QueryRequest
+
+drain:
+	for len(batch) < conn.pipelineDepth {
+		select {
+		case next, ok := <-conn.queryQueue:
+			if !ok {
+				break drain
+			}
+			next = conn.beginRequest(next)
+			if !canPipeline(next) {
+				leftover = &next
+				break drain
+			}
+			batch = append(batch, next)
+		default:
+			break drain
+		}
+	}
+
+	if len(batch) == 1 {
+		conn.complete(first, conn.execute(first))
+		return leftover
+	}
+
+	conn.logger().Debug("pipelining queries", slog.Int("count", len(batch)))
+	entries := make([]*pipelineEntry, len(batch))
+	buf := new(bytes.Buffer)
+	conn.writePendingCloses(buf)
+	for i, req := range batch {
+		entry := &pipelineEntry{original: req, req: req}
+		entries[i] = entry
+		if conn.cacheable(req) {
+			entry.statement, entry.cacheHit = conn.useStatementCache(&entry.req)
+		}
+
+		// Build each request separately so an encoding error only fails that one
+		requestBuf := new(bytes.Buffer)
+		if err := conn.writeRequest(requestBuf, entry.req); err != nil {
+			entry.result = QueryResult{err: err}
+			continue
+		}
+		buf.Write(requestBuf.Bytes())
+		entry.sent = true
+	}
+
+	var streamErr error
+	if err := conn.writeMessages(buf.Bytes()); err != nil {
+		streamErr = fmt.Errorf("error writing messages: %w", err)
+	}
+
+	// Each request completes as soon as its response is read, so a streaming
+	// reader is not held up by the rest of the pipeline
+	var deferred []*pipelineEntry
+	for _, entry := range entries {
+		if entry.sent {
+			conn.readPipelineEntry(entry, &streamErr)
+		}
+		if conn.needsRetry(entry) || (conn.multiplexed && conn.TransactionStatus != "I") {
+			// Retrying or rolling back sends more requests, which has to wait
+			// until the rest of the pipeline is read
+			deferred = append(deferred, entry)
+			continue
+		}
+		conn.complete(entry.original, entry.result)
+	}
+
+	for _, entry := range deferred {
+		if conn.needsRetry(entry) {
+			// Retried after the rest of the pipeline, so it runs out of order
+			conn.dropCachedStatement(entry.statement)
+			entry.result = conn.execute(entry.original)
+		}
+		conn.complete(entry.original, entry.result)
+	}
+
+	return leftover
+}
+
+// readPipelineEntry reads the response of a pipelined request. Once the
+// connection fails, streamErr is set and becomes the result of the rest.
+func (conn *PgConnection) readPipelineEntry(entry *pipelineEntry, streamErr *error) {
+	if *streamErr != nil {
+		entry.result = QueryResult{err: *streamErr}
+		return
+	}
+
+	entry.result = conn.readQueryResponse(entry.req)
+	if entry.result.err != nil && !isServerError(entry.result.err) {
+		// The connection itself failed, nothing after this can be read
+		*streamErr = entry.result.err
+		return
+	}
+	if entry.statement != nil && !entry.cacheHit {
+		if entry.result.err == nil {
+			conn.cacheStatement(entry.statement, entry.result)
+		} else {
+			conn.discardStatement(entry.statement)
+		}
+	}
+}
+
+// needsRetry reports whether a cached plan went stale and the request can
+// run again, i.e. no transaction was aborted by the failure
+func (conn *PgConnection) needsRetry(entry *pipelineEntry) bool {
+	return entry.cacheHit && isCachedPlanChanged(entry.result.err) && conn.TransactionStatus == "I"
+}
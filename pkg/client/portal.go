@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var ErrPortalOutsideTransaction = errors.New("portals require an open transaction")
+
+var portalCounter atomic.Uint64
+
+// PgPortal pages through the result of a command in chunks of fetchSize rows.
+// Portals only live until the end of the transaction they were opened in.
+type PgPortal struct {
+	name      string
+	command   *PgCommand
+	fetchSize int32
+	hasMore   bool
+	closed    bool
+}
+
+func (cmd *PgCommand) OpenPortal(fetchSize int) (*PgPortal, error) {
+	if fetchSize <= 0 {
+		return nil, fmt.Errorf("fetch size must be greater than zero, got %d", fetchSize)
+	}
+	if cmd.connection.multiplexed {
+		return nil, ErrMultiplexedStatement
+	}
+
+	portal := &PgPortal{
+		name:      fmt.Sprintf("pgclient_portal_%d", portalCounter.Add(1)),
+		command:   cmd,
+		fetchSize: int32(fetchSize),
+		hasMore:   true,
+	}
+
+	query, params, err := cmd.positionalQuery()
+	if err != nil {
+		return nil, err
+	}
+	result := portal.send(QueryRequest{
+		kind:   requestOpenPortal,
+		query:  query,
+		params: params,
+	})
+	if result.err != nil {
+		return nil, result.err
+	}
+	return portal, nil
+}
+
+// Fetch returns the next chunk of rows. An empty slice with HasMore false
+// means the portal is exhausted.
+func (portal *PgPortal) Fetch() ([]map[string]any, error) {
+	if portal.closed {
+		return nil, fmt.Errorf("portal %s is closed", portal.name)
+	}
+	if !portal.hasMore {
+		return []map[string]any{}, nil
+	}
+
+	result := portal.send(QueryRequest{
+		kind:    requestFetchPortal,
+		maxRows: portal.fetchSize,
+	})
+	if result.err != nil {
+		portal.hasMore = false
+		return nil, result.err
+	}
+
+	// PortalSuspended means the row limit was hit; CommandComplete means we are done
+	portal.hasMore = result.Suspended
+	return result.Rows, nil
+}
+
+func (portal *PgPortal) HasMore() bool {
+	return portal.hasMore && !portal.closed
+}
+
+func (portal *PgPortal) Close() error {
+	if portal.closed {
+		return nil
+	}
+	portal.closed = true
+	portal.hasMore = false
+
+	result := portal.send(QueryRequest{kind: requestClosePortal})
+	return result.err
+}
+
+func (portal *PgPortal) send(req QueryRequest) QueryResult {
+	resultChan := make(chan QueryResult, 1)
+	req.portal = portal.name
+	req.result = resultChan
+	if err := portal.command.connection.enqueue(context.Background(), req); err != nil {
+		return QueryResult{err: err}
+	}
+
+	return <-resultChan
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// protocolOptionPrefix marks the protocol options a startup message may
+// carry next to the run-time parameters
+const protocolOptionPrefix = "_pq_."
+
+// parseProtocolVersion maps the ProtocolVersion setting to the version sent
+// in the startup message; anything unknown requests 3.0
+func parseProtocolVersion(version string) int32 {
+	switch strings.ToLower(version) {
+	case "3.2", "latest":
+		return message.ProtocolVersion32
+	default:
+		return message.ProtocolVersion30
+	}
+}
+
+func formatProtocolVersion(version int32) string {
+	return fmt.Sprintf("%d.%d", version>>16, version&0xffff)
+}
+
+// ProtocolVersion returns the protocol version agreed with the server, e.g.
+// "3.2", or an empty string before the connection is established
+func (conn *PgConnection) ProtocolVersion() string {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.protocolVersion == 0 {
+		return ""
+	}
+	return formatProtocolVersion(conn.protocolVersion)
+}
+
+// UnrecognizedProtocolOptions returns the _pq_ protocol options the server
+// did not recognize and ignored
+func (conn *PgConnection) UnrecognizedProtocolOptions() []string {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return append([]string(nil), conn.unrecognizedOptions...)
+}
+
+// negotiateProtocol handles the server's answer to a version or options it
+// does not support. The connection continues with the newest minor version
+// the server offers, which is never older than 3.0.
+func (conn *PgConnection) negotiateProtocol(requested int32, msg *message.NegotiateProtocolVersionMessage) error {
+	offered := int32(3<<16) | msg.NewestMinorVersion
+	if msg.NewestMinorVersion < 0 || offered > requested {
+		return fmt.Errorf("server offered invalid protocol version %s for %s", formatProtocolVersion(offered), formatProtocolVersion(requested))
+	}
+
+	conn.mu.Lock()
+	conn.protocolVersion = offered
+	conn.unrecognizedOptions = msg.UnrecognizedOptions
+	conn.mu.Unlock()
+
+	conn.logger().Info("protocol version negotiated",
+		slog.String("requested", formatProtocolVersion(requested)),
+		slog.String("version", formatProtocolVersion(offered)),
+	)
+	if len(msg.UnrecognizedOptions) > 0 {
+		conn.logger().Warn("server ignored protocol options", slog.Any("options", msg.UnrecognizedOptions))
+	}
+	return nil
+}
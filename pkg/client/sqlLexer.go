@@ -0,0 +1,162 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrMixedPlaceholders = errors.New("named parameters cannot be mixed with $n placeholders")
+
+// rewriteNamedParameters replaces :name and @name placeholders for the given
+// parameters with positional $n placeholders. String literals, quoted
+// identifiers, comments, dollar-quoted bodies and :: casts are left alone.
+// It returns the rewritten query and the parameter names in positional order,
+// empty if no placeholder was found. A query that already uses $n
+// placeholders cannot also use named ones, as their positions would collide.
+func rewriteNamedParameters(query string, isParameter func(name string) bool) (string, []string, error) {
+	var out strings.Builder
+	positions := make(map[string]int)
+	names := make([]string, 0)
+	positional := false
+
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// E'...' strings allow backslash escapes
+			escapes := i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i < 2 || !isIdentChar(query[i-2]))
+			end := skipQuoted(query, i, '\'', escapes)
+			out.WriteString(query[i:end])
+			i = end
+		case c == '"':
+			end := skipQuoted(query, i, '"', false)
+			out.WriteString(query[i:end])
+			i = end
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i
+			}
+			out.WriteString(query[i:end])
+			i = end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := skipBlockComment(query, i)
+			out.WriteString(query[i:end])
+			i = end
+		case c == '$' && (i == 0 || !isIdentChar(query[i-1])):
+			if i+1 < len(query) && isDigit(query[i+1]) {
+				positional = true
+			}
+			end := skipDollarQuoted(query, i)
+			out.WriteString(query[i:end])
+			i = end
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// type cast
+			out.WriteString("::")
+			i += 2
+		case (c == ':' || c == '@') && (i == 0 || !isIdentChar(query[i-1])):
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			if name == "" || isDigit(name[0]) || !isParameter(name) {
+				out.WriteByte(c)
+				i++
+				continue
+			}
+
+			position, ok := positions[name]
+			if !ok {
+				names = append(names, name)
+				position = len(names)
+				positions[name] = position
+			}
+			out.WriteString("$" + strconv.Itoa(position))
+			i = end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	if positional && len(names) > 0 {
+		return "", nil, ErrMixedPlaceholders
+	}
+	return out.String(), names, nil
+}
+
+// skipQuoted returns the index just past the closing quote, treating a doubled
+// quote as an escaped one
+func skipQuoted(query string, start int, quote byte, backslashEscapes bool) int {
+	i := start + 1
+	for i < len(query) {
+		switch {
+		case backslashEscapes && query[i] == '\\':
+			i += 2
+		case query[i] == quote && i+1 < len(query) && query[i+1] == quote:
+			i += 2
+		case query[i] == quote:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(query)
+}
+
+// skipBlockComment returns the index just past a possibly nested /* */ comment
+func skipBlockComment(query string, start int) int {
+	depth := 0
+	i := start
+	for i+1 < len(query) {
+		switch {
+		case query[i] == '/' && query[i+1] == '*':
+			depth++
+			i += 2
+		case query[i] == '*' && query[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(query)
+}
+
+// skipDollarQuoted returns the index just past a $tag$...$tag$ body, or just
+// past the '$' when it does not open one (e.g. a $1 placeholder)
+func skipDollarQuoted(query string, start int) int {
+	end := start + 1
+	for end < len(query) && query[end] != '$' {
+		if !isIdentChar(query[end]) || (end == start+1 && isDigit(query[end])) {
+			return start + 1
+		}
+		end++
+	}
+	if end >= len(query) {
+		return start + 1
+	}
+
+	tag := query[start : end+1]
+	closing := strings.Index(query[end+1:], tag)
+	if closing < 0 {
+		return len(query)
+	}
+	return end + 1 + closing + len(tag)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
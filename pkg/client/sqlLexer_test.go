@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRewriteNamedParameters(t *testing.T) {
+	params := map[string]bool{"id": true, "name": true, "tags": true, "text": true}
+	isParameter := func(name string) bool { return params[name] }
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		names []string
+		err   error
+	}{
+		{"colon and at", "select * from t where id = :id and name = @name", "select * from t where id = $1 and name = $2", []string{"id", "name"}, nil},
+		{"repeated parameter", "select :id, :name, :id", "select $1, $2, $1", []string{"id", "name"}, nil},
+		{"no placeholders", "select 1", "select 1", []string{}, nil},
+		{"string literal", "select ':id', 'it''s :name' from t where id = :id", "select ':id', 'it''s :name' from t where id = $1", []string{"id"}, nil},
+		{"quoted identifier", `select ":id", "a""@name" from t where id = :id`, `select ":id", "a""@name" from t where id = $1`, []string{"id"}, nil},
+		{"escape string", `select E'\' :id', e'\\' || :name`, `select E'\' :id', e'\\' || $1`, []string{"name"}, nil},
+		{"backslash in plain string", `select '\' || :id`, `select '\' || $1`, []string{"id"}, nil},
+		{"identifier ending in e", `select some'x :id'`, `select some'x :id'`, []string{}, nil},
+		{"dollar quote", "select $$ :id $$, :name", "select $$ :id $$, $1", []string{"name"}, nil},
+		{"tagged dollar quote", "select $fn$ :id $$ @name $fn$, :name", "select $fn$ :id $$ @name $fn$, $1", []string{"name"}, nil},
+		{"line comment", "select :id -- :name\n, :tags", "select $1 -- :name\n, $2", []string{"id", "tags"}, nil},
+		{"line comment at end", "select :id -- :name", "select $1 -- :name", []string{"id"}, nil},
+		{"block comment", "select /* :id /* nested :name */ :tags */ :name", "select /* :id /* nested :name */ :tags */ $1", []string{"name"}, nil},
+		{"cast", "select :id::text, x::text", "select $1::text, x::text", []string{"id"}, nil},
+		{"containment operator", "select * from t where tags @> :tags", "select * from t where tags @> $1", []string{"tags"}, nil},
+		{"unset parameter", "select :id, :missing, @other", "select $1, :missing, @other", []string{"id"}, nil},
+		{"inside identifier", "select a:id, user@name", "select a:id, user@name", []string{}, nil},
+		{"array slice", "select arr[1:2]", "select arr[1:2]", []string{}, nil},
+		{"positional only", "select $1, $2", "select $1, $2", []string{}, nil},
+		{"positional in literal", "select '$1', :id", "select '$1', $1", []string{"id"}, nil},
+		{"mixed placeholders", "select $1, :id", "", nil, ErrMixedPlaceholders},
+		{"mixed placeholders after", "select :id, $2", "", nil, ErrMixedPlaceholders},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, names, err := rewriteNamedParameters(tt.query, isParameter)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if got != tt.want || !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("got %q %q, want %q %q", got, names, tt.want, tt.names)
+			}
+		})
+	}
+}
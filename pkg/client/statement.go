@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var statementCounter atomic.Uint64
+
+// preparedStatement is a named server-side statement together with the
+// parameter and result descriptions returned when it was prepared
+type preparedStatement struct {
+	name      string
+	query     string
+	paramOIDs []Oid
+	fields    []RowDescription
+	cacheKey  string // set for statements of the statement cache
+}
+
+func newStatementName() string {
+	return fmt.Sprintf("pgclient_stmt_%d", statementCounter.Add(1))
+}
+
+// Prepare creates a named statement on the server. Later executions of the
+// command only send Bind and Execute until Unprepare is called or the command
+// text changes.
+func (cmd *PgCommand) Prepare() error {
+	if cmd.connection.multiplexed {
+		return ErrMultiplexedStatement
+	}
+	if cmd.prepared != nil {
+		if err := cmd.Unprepare(); err != nil {
+			return err
+		}
+	}
+
+	query, params, err := cmd.positionalQuery()
+	if err != nil {
+		return err
+	}
+	statement := &preparedStatement{
+		name:  newStatementName(),
+		query: query,
+	}
+
+	result := cmd.send(QueryRequest{
+		kind:      requestPrepare,
+		query:     query,
+		params:    params,
+		statement: statement,
+	})
+	if result.err != nil {
+		return result.err
+	}
+
+	statement.paramOIDs = result.paramOIDs
+	statement.fields = result.fields
+	cmd.prepared = statement
+	return nil
+}
+
+// Unprepare closes the named statement on the server
+func (cmd *PgCommand) Unprepare() error {
+	if cmd.prepared == nil {
+		return nil
+	}
+	statement := cmd.prepared
+	cmd.prepared = nil
+
+	result := cmd.send(QueryRequest{
+		kind:      requestUnprepare,
+		statement: statement,
+	})
+	return result.err
+}
+
+func (cmd *PgCommand) IsPrepared() bool {
+	return cmd.prepared != nil
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"container/list"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type StatementCacheMode int
+
+const (
+	// StatementCachePrepare keeps named statements on the server and only
+	// sends Bind/Execute for cached queries
+	StatementCachePrepare StatementCacheMode = iota
+	// StatementCacheDescribe only caches parameter types and re-parses the
+	// unnamed statement, which is safe behind PgBouncer in transaction
+	// pooling mode
+	StatementCacheDescribe
+	StatementCacheDisabled
+)
+
+const defaultStatementCacheCapacity = 256
+
+// SQLSTATE returned when a cached plan no longer matches the table definition
+const cachedPlanChangedCode = "0A000"
+
+// statementCache is an LRU of statements keyed by SQL text and the parameter
+// types requested for it. It is only used from the ProcessQueries goroutine
+// and needs no locking.
+type statementCache struct {
+	mode     StatementCacheMode
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+func newStatementCache(mode StatementCacheMode, capacity int) *statementCache {
+	if capacity <= 0 {
+		capacity = defaultStatementCacheCapacity
+	}
+	return &statementCache{
+		mode:     mode,
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// statementKey keys a query by its parameter types as well, since a statement
+// is parsed with the types of the request that prepared it
+func statementKey(query string, paramOIDs []Oid) string {
+	var key strings.Builder
+	key.WriteString(query)
+	for _, oid := range paramOIDs {
+		key.WriteByte(0)
+		key.WriteString(strconv.FormatUint(uint64(oid), 10))
+	}
+	return key.String()
+}
+
+func (cache *statementCache) get(key string) *preparedStatement {
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	cache.lru.MoveToFront(element)
+	return element.Value.(*preparedStatement)
+}
+
+// put stores the statement and returns the statements pushed out of the cache
+func (cache *statementCache) put(statement *preparedStatement) []*preparedStatement {
+	evicted := make([]*preparedStatement, 0)
+	if previous := cache.remove(statement.cacheKey); previous != nil {
+		evicted = append(evicted, previous)
+	}
+
+	cache.entries[statement.cacheKey] = cache.lru.PushFront(statement)
+	for cache.lru.Len() > cache.capacity {
+		oldest := cache.lru.Back()
+		evicted = append(evicted, cache.remove(oldest.Value.(*preparedStatement).cacheKey))
+	}
+	return evicted
+}
+
+func (cache *statementCache) remove(key string) *preparedStatement {
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	delete(cache.entries, key)
+	cache.lru.Remove(element)
+	return element.Value.(*preparedStatement)
+}
+
+func parseStatementCacheMode(mode string) StatementCacheMode {
+	switch strings.ToLower(mode) {
+	case "describe":
+		return StatementCacheDescribe
+	case "disable", "disabled", "off":
+		return StatementCacheDisabled
+	default:
+		return StatementCachePrepare
+	}
+}
+
+func parseStatementCacheCapacity(capacity string) int {
+	value, err := strconv.Atoi(capacity)
+	if err != nil {
+		return defaultStatementCacheCapacity
+	}
+	return value
+}
+
+// executeCached runs a parameterized query through the statement cache. A
+// stale cached plan is dropped and the query retried once, as long as no
+// transaction was aborted by the failure.
+func (conn *PgConnection) executeCached(req QueryRequest) QueryResult {
+	result, statement := conn.executeWithCache(req)
+	if statement == nil || !isCachedPlanChanged(result.err) || conn.TransactionStatus != "I" {
+		return result
+	}
+
+	conn.dropCachedStatement(statement)
+	result, _ = conn.executeWithCache(req)
+	return result
+}
+
+// executeWithCache returns the cached statement that was used, if any
+func (conn *PgConnection) executeWithCache(req QueryRequest) (QueryResult, *preparedStatement) {
+	statement, hit := conn.useStatementCache(&req)
+	result := conn.roundTrip(req)
+	if hit {
+		return result, statement
+	}
+	if result.err == nil {
+		conn.cacheStatement(statement, result)
+	} else {
+		conn.discardStatement(statement)
+	}
+	return result, nil
+}
+
+func (conn *PgConnection) cacheable(req QueryRequest) bool {
+	return req.kind == requestQuery && len(req.params) > 0 && conn.statements.mode != StatementCacheDisabled
+}
+
+// useStatementCache points the request at the cached statement for its query.
+// On a miss it returns the new statement to cache once the request succeeds.
+func (conn *PgConnection) useStatementCache(req *QueryRequest) (*preparedStatement, bool) {
+	cache := conn.statements
+	key := statementKey(req.query, parameterOIDs(req.params))
+	if cached := cache.get(key); cached != nil {
+		req.statement = cached
+		if cache.mode == StatementCachePrepare {
+			req.kind = requestExecutePrepared
+		} else {
+			req.kind = requestExecuteDescribed
+		}
+		return cached, true
+	}
+
+	statement := &preparedStatement{query: req.query, cacheKey: key}
+	if cache.mode == StatementCachePrepare {
+		statement.name = newStatementName()
+		req.kind = requestPrepareExecute
+		req.statement = statement
+	}
+	return statement, false
+}
+
+func (conn *PgConnection) cacheStatement(statement *preparedStatement, result QueryResult) {
+	statement.paramOIDs = result.paramOIDs
+	statement.fields = result.fields
+	for _, evicted := range conn.statements.put(statement) {
+		if evicted.name != "" {
+			conn.pendingCloses = append(conn.pendingCloses, evicted.name)
+		}
+	}
+}
+
+// dropCachedStatement removes a statement whose cached plan went stale
+func (conn *PgConnection) dropCachedStatement(statement *preparedStatement) {
+	if conn.statements.remove(statement.cacheKey) != nil && statement.name != "" {
+		conn.pendingCloses = append(conn.pendingCloses, statement.name)
+	}
+}
+
+// discardStatement closes the statement of a cache miss that failed. Parse
+// may have succeeded before Bind or Execute failed, and closing a statement
+// that does not exist is harmless.
+func (conn *PgConnection) discardStatement(statement *preparedStatement) {
+	if statement.name != "" {
+		conn.pendingCloses = append(conn.pendingCloses, statement.name)
+	}
+}
+
+func isCachedPlanChanged(err error) bool {
+	var pgErr *PgError
+	return errors.As(err, &pgErr) && pgErr.Code == cachedPlanChangedCode
+}
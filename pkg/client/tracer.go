@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// TraceEvent is the kind of operation a trace covers
+type TraceEvent int
+
+const (
+	TraceConnect TraceEvent = iota
+	TraceQuery
+	TracePrepare
+	TraceBatch
+	TraceCopy
+	// TraceTransaction covers transaction control statements such as BEGIN,
+	// COMMIT, ROLLBACK and SAVEPOINT
+	TraceTransaction
+)
+
+func (event TraceEvent) String() string {
+	switch event {
+	case TraceConnect:
+		return "connect"
+	case TraceQuery:
+		return "query"
+	case TracePrepare:
+		return "prepare"
+	case TraceBatch:
+		return "batch"
+	case TraceCopy:
+		return "copy"
+	case TraceTransaction:
+		return "transaction"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceStartData describes an operation that is about to run
+type TraceStartData struct {
+	Event      TraceEvent
+	SQL        string // statements of a batch are joined with "; "
+	ParamCount int
+}
+
+// TraceEndData describes how an operation finished
+type TraceEndData struct {
+	Event        TraceEvent
+	SQL          string
+	ParamCount   int
+	RowsAffected int64 // -1 when no statement changed rows, see QueryResult.RowsAffected
+	Err          error
+	Duration     time.Duration
+}
+
+// Tracer is told when operations on a connection start and end. The context
+// returned by TraceStart is passed to the matching TraceEnd, so a span can be
+// carried between them. Operations are timed from the moment the connection
+// picks them up, not from when they were queued. Both calls are made on the
+// goroutine that owns the socket and must not block.
+type Tracer interface {
+	TraceStart(ctx context.Context, conn *PgConnection, data TraceStartData) context.Context
+	TraceEnd(ctx context.Context, conn *PgConnection, data TraceEndData)
+}
+
+// SetTracer sets the tracer of the connection; nil disables tracing
+func (conn *PgConnection) SetTracer(tracer Tracer) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.tracer = tracer
+}
+
+func (conn *PgConnection) currentTracer() Tracer {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return conn.tracer
+}
+
+// traceSpan is an operation that has started but not yet ended
+type traceSpan struct {
+	tracer Tracer
+	ctx    context.Context
+	start  TraceStartData
+	began  time.Time
+}
+
+func (conn *PgConnection) startTrace(ctx context.Context, data TraceStartData) *traceSpan {
+	tracer := conn.currentTracer()
+	if tracer == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &traceSpan{
+		tracer: tracer,
+		ctx:    tracer.TraceStart(ctx, conn, data),
+		start:  data,
+		began:  time.Now(),
+	}
+}
+
+func (conn *PgConnection) endTrace(span *traceSpan, rowsAffected int64, err error) {
+	if span == nil {
+		return
+	}
+	span.tracer.TraceEnd(span.ctx, conn, TraceEndData{
+		Event:        span.start.Event,
+		SQL:          span.start.SQL,
+		ParamCount:   span.start.ParamCount,
+		RowsAffected: rowsAffected,
+		Err:          err,
+		Duration:     time.Since(span.began),
+	})
+}
+
+// beginRequest starts the trace and timing of a request as the connection
+// picks it up
+func (conn *PgConnection) beginRequest(req QueryRequest) QueryRequest {
+	if conn.currentMetrics() != nil {
+		req.started = time.Now()
+	}
+	if conn.currentTracer() == nil {
+		return req
+	}
+
+	data := TraceStartData{Event: requestEvent(req), SQL: req.query, ParamCount: len(req.params)}
+	switch req.kind {
+	case requestPrepare, requestUnprepare, requestDescribe:
+		if req.statement != nil && data.SQL == "" {
+			data.SQL = req.statement.query
+		}
+	case requestExecutePrepared:
+		data.SQL = req.statement.query
+	case requestBatch:
+		statements := make([]string, len(req.batch))
+		for i, command := range req.batch {
+			statements[i] = command.query
+			data.ParamCount += len(command.params)
+		}
+		data.SQL = strings.Join(statements, "; ")
+	}
+
+	req.trace = conn.startTrace(req.ctx, data)
+	return req
+}
+
+func requestEvent(req QueryRequest) TraceEvent {
+	switch req.kind {
+	case requestPrepare, requestUnprepare, requestDescribe:
+		return TracePrepare
+	case requestBatch:
+		return TraceBatch
+	case requestCopyIn, requestCopyOut:
+		return TraceCopy
+	case requestQuery:
+		if isTransactionControl(req.query) {
+			return TraceTransaction
+		}
+	}
+	return TraceQuery
+}
+
+// endRequestTrace ends the trace of a request with its result
+func (conn *PgConnection) endRequestTrace(req QueryRequest, result QueryResult) {
+	if req.trace == nil {
+		return
+	}
+
+	rowsAffected := result.RowsAffected()
+	for i := range result.batch {
+		if rows := result.batch[i].RowsAffected(); rows >= 0 {
+			rowsAffected = max(rowsAffected, 0) + rows
+		}
+	}
+	conn.endTrace(req.trace, rowsAffected, result.err)
+}
+
+var transactionKeywords = []string{"BEGIN", "START", "COMMIT", "END", "ROLLBACK", "ABORT", "SAVEPOINT", "RELEASE", "PREPARE TRANSACTION"}
+
+// isTransactionControl reports whether sql starts with a transaction control
+// keyword
+func isTransactionControl(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	for _, keyword := range transactionKeywords {
+		if !strings.HasPrefix(sql, keyword) {
+			continue
+		}
+		rest := sql[len(keyword):]
+		if rest == "" || !isIdentChar(rest[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package client
+
+// Oid identifies a PostgreSQL data type
+type Oid uint32
+
+// OIDs of the built-in types, as listed in pg_type
+const (
+	UnspecifiedOID Oid = 0 // let the server infer the type
+	BoolOID        Oid = 16
+	ByteaOID       Oid = 17
+	CharOID        Oid = 18
+	NameOID        Oid = 19
+	Int8OID        Oid = 20
+	Int2OID        Oid = 21
+	Int4OID        Oid = 23
+	TextOID        Oid = 25
+	OIDOID         Oid = 26
+	JSONOID        Oid = 114
+	XMLOID         Oid = 142
+	Float4OID      Oid = 700
+	Float8OID      Oid = 701
+	UnknownOID     Oid = 705
+	BPCharOID      Oid = 1042
+	VarcharOID     Oid = 1043
+	DateOID        Oid = 1082
+	TimeOID        Oid = 1083
+	TimestampOID   Oid = 1114
+	TimestamptzOID Oid = 1184
+	IntervalOID    Oid = 1186
+	NumericOID     Oid = 1700
+	UUIDOID        Oid = 2950
+	JSONBOID       Oid = 3802
+)
@@ -0,0 +1,691 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownMessageType is returned when decoding a message of a type the
+// package has no struct for
+var ErrUnknownMessageType = errors.New("unknown message type")
+
+// NegotiateProtocolVersion is sent when the server does not support the
+// requested minor version or protocol options
+const NegotiateProtocolVersion MessageType = 'v'
+
+// Authentication request codes
+const (
+	AuthOk                = 0
+	AuthKerberosV5        = 2
+	AuthCleartextPassword = 3
+	AuthMD5Password       = 5
+	AuthGSS               = 7
+	AuthGSSContinue       = 8
+	AuthSSPI              = 9
+	AuthSASL              = 10
+	AuthSASLContinue      = 11
+	AuthSASLFinal         = 12
+)
+
+// appendAuthentication encodes an authentication request with an optional payload
+func appendAuthentication(dst []byte, code int32, payload []byte) []byte {
+	dst, start := beginMessage(dst, byte(AuthenticationOK))
+	dst = appendInt32(dst, code)
+	dst = append(dst, payload...)
+	return finishMessage(dst, start)
+}
+
+// decodeAuthentication checks the code of an authentication request and
+// returns its payload
+func decodeAuthentication(body []byte, code int32, name string) ([]byte, error) {
+	d := &decoder{buf: body}
+	if got := d.int32(); d.err == nil && got != code {
+		return nil, fmt.Errorf("invalid %s message: authentication code %d", name, got)
+	}
+	payload := d.rest()
+	return payload, d.finish(name)
+}
+
+type AuthenticationOk struct{}
+
+func (msg *AuthenticationOk) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthOk, nil)
+}
+
+func (msg *AuthenticationOk) Decode(body []byte) error {
+	_, err := decodeAuthentication(body, AuthOk, "AuthenticationOk")
+	return err
+}
+
+type AuthenticationKerberosV5 struct{}
+
+func (msg *AuthenticationKerberosV5) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthKerberosV5, nil)
+}
+
+func (msg *AuthenticationKerberosV5) Decode(body []byte) error {
+	_, err := decodeAuthentication(body, AuthKerberosV5, "AuthenticationKerberosV5")
+	return err
+}
+
+type AuthenticationCleartextPassword struct{}
+
+func (msg *AuthenticationCleartextPassword) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthCleartextPassword, nil)
+}
+
+func (msg *AuthenticationCleartextPassword) Decode(body []byte) error {
+	_, err := decodeAuthentication(body, AuthCleartextPassword, "AuthenticationCleartextPassword")
+	return err
+}
+
+type AuthenticationMD5Password struct {
+	Salt [4]byte
+}
+
+func (msg *AuthenticationMD5Password) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthMD5Password, msg.Salt[:])
+}
+
+func (msg *AuthenticationMD5Password) Decode(body []byte) error {
+	payload, err := decodeAuthentication(body, AuthMD5Password, "AuthenticationMD5Password")
+	if err != nil {
+		return err
+	}
+	if len(payload) != len(msg.Salt) {
+		return fmt.Errorf("invalid AuthenticationMD5Password message: salt of %d bytes", len(payload))
+	}
+	copy(msg.Salt[:], payload)
+	return nil
+}
+
+type AuthenticationGSS struct{}
+
+func (msg *AuthenticationGSS) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthGSS, nil)
+}
+
+func (msg *AuthenticationGSS) Decode(body []byte) error {
+	_, err := decodeAuthentication(body, AuthGSS, "AuthenticationGSS")
+	return err
+}
+
+type AuthenticationGSSContinue struct {
+	Data []byte
+}
+
+func (msg *AuthenticationGSSContinue) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthGSSContinue, msg.Data)
+}
+
+func (msg *AuthenticationGSSContinue) Decode(body []byte) error {
+	var err error
+	msg.Data, err = decodeAuthentication(body, AuthGSSContinue, "AuthenticationGSSContinue")
+	return err
+}
+
+type AuthenticationSSPI struct{}
+
+func (msg *AuthenticationSSPI) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthSSPI, nil)
+}
+
+func (msg *AuthenticationSSPI) Decode(body []byte) error {
+	_, err := decodeAuthentication(body, AuthSSPI, "AuthenticationSSPI")
+	return err
+}
+
+type AuthenticationSASL struct {
+	Mechanisms []string
+}
+
+func (msg *AuthenticationSASL) Encode(dst []byte) []byte {
+	var payload []byte
+	for _, mechanism := range msg.Mechanisms {
+		payload = appendCString(payload, mechanism)
+	}
+	payload = append(payload, 0)
+	return appendAuthentication(dst, AuthSASL, payload)
+}
+
+func (msg *AuthenticationSASL) Decode(body []byte) error {
+	payload, err := decodeAuthentication(body, AuthSASL, "AuthenticationSASL")
+	if err != nil {
+		return err
+	}
+	d := &decoder{buf: payload}
+	msg.Mechanisms = nil
+	for d.err == nil {
+		mechanism := d.cstring()
+		if mechanism == "" {
+			break
+		}
+		msg.Mechanisms = append(msg.Mechanisms, mechanism)
+	}
+	return d.finish("AuthenticationSASL")
+}
+
+type AuthenticationSASLContinue struct {
+	Data []byte
+}
+
+func (msg *AuthenticationSASLContinue) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthSASLContinue, msg.Data)
+}
+
+func (msg *AuthenticationSASLContinue) Decode(body []byte) error {
+	var err error
+	msg.Data, err = decodeAuthentication(body, AuthSASLContinue, "AuthenticationSASLContinue")
+	return err
+}
+
+type AuthenticationSASLFinal struct {
+	Data []byte
+}
+
+func (msg *AuthenticationSASLFinal) Encode(dst []byte) []byte {
+	return appendAuthentication(dst, AuthSASLFinal, msg.Data)
+}
+
+func (msg *AuthenticationSASLFinal) Decode(body []byte) error {
+	var err error
+	msg.Data, err = decodeAuthentication(body, AuthSASLFinal, "AuthenticationSASLFinal")
+	return err
+}
+
+// DecodeAuthentication decodes the body of an authentication request into
+// the variant its code names
+func DecodeAuthentication(body []byte) (Message, error) {
+	d := &decoder{buf: body}
+	code := d.int32()
+	if err := d.finish("Authentication"); err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	switch code {
+	case AuthOk:
+		msg = &AuthenticationOk{}
+	case AuthKerberosV5:
+		msg = &AuthenticationKerberosV5{}
+	case AuthCleartextPassword:
+		msg = &AuthenticationCleartextPassword{}
+	case AuthMD5Password:
+		msg = &AuthenticationMD5Password{}
+	case AuthGSS:
+		msg = &AuthenticationGSS{}
+	case AuthGSSContinue:
+		msg = &AuthenticationGSSContinue{}
+	case AuthSSPI:
+		msg = &AuthenticationSSPI{}
+	case AuthSASL:
+		msg = &AuthenticationSASL{}
+	case AuthSASLContinue:
+		msg = &AuthenticationSASLContinue{}
+	case AuthSASLFinal:
+		msg = &AuthenticationSASLFinal{}
+	default:
+		return nil, fmt.Errorf("unsupported authentication code %d", code)
+	}
+	return msg, msg.Decode(body)
+}
+
+type BackendKeyDataMessage struct {
+	ProcessID int32
+	SecretKey []byte // 4 bytes in protocol 3.0, up to MaxSecretKeyLength in 3.2
+}
+
+func (msg *BackendKeyDataMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(BackendKeyData))
+	dst = appendInt32(dst, msg.ProcessID)
+	dst = append(dst, msg.SecretKey...)
+	return finishMessage(dst, start)
+}
+
+func (msg *BackendKeyDataMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.ProcessID = d.int32()
+	msg.SecretKey = d.rest()
+	if err := d.finish("BackendKeyData"); err != nil {
+		return err
+	}
+	if len(msg.SecretKey) < 4 || len(msg.SecretKey) > MaxSecretKeyLength {
+		return fmt.Errorf("invalid BackendKeyData message: secret key of %d bytes", len(msg.SecretKey))
+	}
+	return nil
+}
+
+type BindCompleteMessage struct{}
+
+func (msg *BindCompleteMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(BindComplete))
+	return finishMessage(dst, start)
+}
+
+func (msg *BindCompleteMessage) Decode(body []byte) error { return nil }
+
+type CloseCompleteMessage struct{}
+
+func (msg *CloseCompleteMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(CloseComplete))
+	return finishMessage(dst, start)
+}
+
+func (msg *CloseCompleteMessage) Decode(body []byte) error { return nil }
+
+type CommandCompleteMessage struct {
+	Tag string
+}
+
+func (msg *CommandCompleteMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(CommandComplete))
+	dst = appendCString(dst, msg.Tag)
+	return finishMessage(dst, start)
+}
+
+func (msg *CommandCompleteMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Tag = d.cstring()
+	return d.finish("CommandComplete")
+}
+
+// CopyResponseMessage is the body shared by CopyInResponse, CopyOutResponse
+// and CopyBothResponse
+type CopyResponseMessage struct {
+	Type          MessageType // CopyInResponse, CopyOutResponse or CopyBothResponse
+	Format        int8        // 0 text, 1 binary
+	ColumnFormats []int16
+}
+
+func (msg *CopyResponseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(msg.Type))
+	dst = append(dst, byte(msg.Format))
+	dst = appendInt16(dst, int16(len(msg.ColumnFormats)))
+	for _, format := range msg.ColumnFormats {
+		dst = appendInt16(dst, format)
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *CopyResponseMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Format = int8(d.byte())
+	msg.ColumnFormats = make([]int16, d.count(2))
+	for i := range msg.ColumnFormats {
+		msg.ColumnFormats[i] = d.int16()
+	}
+	return d.finish(msg.Type.String())
+}
+
+// CopyDataMessage is sent in both directions
+type CopyDataMessage struct {
+	Data []byte
+}
+
+func (msg *CopyDataMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(CopyData))
+	dst = append(dst, msg.Data...)
+	return finishMessage(dst, start)
+}
+
+func (msg *CopyDataMessage) Decode(body []byte) error {
+	msg.Data = append([]byte{}, body...)
+	return nil
+}
+
+// CopyDoneMessage is sent in both directions
+type CopyDoneMessage struct{}
+
+func (msg *CopyDoneMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(CopyDone))
+	return finishMessage(dst, start)
+}
+
+func (msg *CopyDoneMessage) Decode(body []byte) error { return nil }
+
+// DataRowMessage is decoded without copying the values, which are the
+// hottest path of a query. Values share the memory of the decoded body, so
+// with a PgReader they are only valid until the next read.
+type DataRowMessage struct {
+	Values [][]byte // nil values are NULL
+}
+
+func (msg *DataRowMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(DataRow))
+	dst = appendInt16(dst, int16(len(msg.Values)))
+	for _, value := range msg.Values {
+		dst = appendValue(dst, value)
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *DataRowMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Values = make([][]byte, d.count(4))
+	for i := range msg.Values {
+		msg.Values[i] = d.valueView()
+	}
+	return d.finish("DataRow")
+}
+
+type EmptyQueryResponseMessage struct{}
+
+func (msg *EmptyQueryResponseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(EmptyQueryResponse))
+	return finishMessage(dst, start)
+}
+
+func (msg *EmptyQueryResponseMessage) Decode(body []byte) error { return nil }
+
+// ErrorFieldsMessage is the body shared by ErrorResponse and NoticeResponse,
+// fields keyed by their code ('S' severity, 'C' SQLSTATE, 'M' message, ...)
+type ErrorFieldsMessage struct {
+	Type   MessageType // ErrorResponse or NoticeResponse
+	Fields map[byte]string
+}
+
+func (msg *ErrorFieldsMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(msg.Type))
+	codes := make([]byte, 0, len(msg.Fields))
+	for code := range msg.Fields {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		dst = append(dst, code)
+		dst = appendCString(dst, msg.Fields[code])
+	}
+	dst = append(dst, 0)
+	return finishMessage(dst, start)
+}
+
+func (msg *ErrorFieldsMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Fields = make(map[byte]string)
+	for d.err == nil {
+		code := d.byte()
+		if code == 0 {
+			break
+		}
+		msg.Fields[code] = d.cstring()
+	}
+	return d.finish(msg.Type.String())
+}
+
+type FunctionCallResponseMessage struct {
+	Result []byte // nil is NULL
+}
+
+func (msg *FunctionCallResponseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(FunctionCallResponse))
+	dst = appendValue(dst, msg.Result)
+	return finishMessage(dst, start)
+}
+
+func (msg *FunctionCallResponseMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Result = d.value()
+	return d.finish("FunctionCallResponse")
+}
+
+type NegotiateProtocolVersionMessage struct {
+	NewestMinorVersion  int32
+	UnrecognizedOptions []string
+}
+
+func (msg *NegotiateProtocolVersionMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(NegotiateProtocolVersion))
+	dst = appendInt32(dst, msg.NewestMinorVersion)
+	dst = appendInt32(dst, int32(len(msg.UnrecognizedOptions)))
+	for _, option := range msg.UnrecognizedOptions {
+		dst = appendCString(dst, option)
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *NegotiateProtocolVersionMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.NewestMinorVersion = d.int32()
+	count := int(d.int32())
+	if count < 0 || count > len(body) {
+		return fmt.Errorf("invalid NegotiateProtocolVersion message: %d options", count)
+	}
+	msg.UnrecognizedOptions = make([]string, count)
+	for i := range msg.UnrecognizedOptions {
+		msg.UnrecognizedOptions[i] = d.cstring()
+	}
+	return d.finish("NegotiateProtocolVersion")
+}
+
+type NoDataMessage struct{}
+
+func (msg *NoDataMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(NoData))
+	return finishMessage(dst, start)
+}
+
+func (msg *NoDataMessage) Decode(body []byte) error { return nil }
+
+type NotificationResponseMessage struct {
+	ProcessID int32
+	Channel   string
+	Payload   string
+}
+
+func (msg *NotificationResponseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(NotificationResponse))
+	dst = appendInt32(dst, msg.ProcessID)
+	dst = appendCString(dst, msg.Channel)
+	dst = appendCString(dst, msg.Payload)
+	return finishMessage(dst, start)
+}
+
+func (msg *NotificationResponseMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.ProcessID = d.int32()
+	msg.Channel = d.cstring()
+	msg.Payload = d.cstring()
+	return d.finish("NotificationResponse")
+}
+
+type ParameterDescriptionMessage struct {
+	ParameterOIDs []uint32
+}
+
+func (msg *ParameterDescriptionMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(ParameterDescription))
+	dst = appendInt16(dst, int16(len(msg.ParameterOIDs)))
+	for _, oid := range msg.ParameterOIDs {
+		dst = appendInt32(dst, int32(oid))
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *ParameterDescriptionMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.ParameterOIDs = make([]uint32, d.count(4))
+	for i := range msg.ParameterOIDs {
+		msg.ParameterOIDs[i] = uint32(d.int32())
+	}
+	return d.finish("ParameterDescription")
+}
+
+type ParameterStatusMessage struct {
+	Name  string
+	Value string
+}
+
+func (msg *ParameterStatusMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(ParameterStatus))
+	dst = appendCString(dst, msg.Name)
+	dst = appendCString(dst, msg.Value)
+	return finishMessage(dst, start)
+}
+
+func (msg *ParameterStatusMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Name = d.cstring()
+	msg.Value = d.cstring()
+	return d.finish("ParameterStatus")
+}
+
+type ParseCompleteMessage struct{}
+
+func (msg *ParseCompleteMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(ParseComplete))
+	return finishMessage(dst, start)
+}
+
+func (msg *ParseCompleteMessage) Decode(body []byte) error { return nil }
+
+type PortalSuspendedMessage struct{}
+
+func (msg *PortalSuspendedMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(PortalSuspended))
+	return finishMessage(dst, start)
+}
+
+func (msg *PortalSuspendedMessage) Decode(body []byte) error { return nil }
+
+type ReadyForQueryMessage struct {
+	TxStatus byte // 'I' idle, 'T' in a transaction, 'E' in a failed transaction
+}
+
+func (msg *ReadyForQueryMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(ReadyForQuery))
+	dst = append(dst, msg.TxStatus)
+	return finishMessage(dst, start)
+}
+
+func (msg *ReadyForQueryMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.TxStatus = d.byte()
+	return d.finish("ReadyForQuery")
+}
+
+type FieldDescription struct {
+	Name            string
+	TableOID        uint32
+	AttributeNumber int16
+	DataTypeOID     uint32
+	DataTypeSize    int16
+	TypeModifier    int32
+	Format          int16
+}
+
+type RowDescriptionMessage struct {
+	Fields []FieldDescription
+}
+
+func (msg *RowDescriptionMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(RowDescription))
+	dst = appendInt16(dst, int16(len(msg.Fields)))
+	for _, field := range msg.Fields {
+		dst = appendCString(dst, field.Name)
+		dst = appendInt32(dst, int32(field.TableOID))
+		dst = appendInt16(dst, field.AttributeNumber)
+		dst = appendInt32(dst, int32(field.DataTypeOID))
+		dst = appendInt16(dst, field.DataTypeSize)
+		dst = appendInt32(dst, field.TypeModifier)
+		dst = appendInt16(dst, field.Format)
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *RowDescriptionMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Fields = make([]FieldDescription, d.count(19))
+	for i := range msg.Fields {
+		field := &msg.Fields[i]
+		field.Name = d.cstring()
+		field.TableOID = uint32(d.int32())
+		field.AttributeNumber = d.int16()
+		field.DataTypeOID = uint32(d.int32())
+		field.DataTypeSize = d.int16()
+		field.TypeModifier = d.int32()
+		field.Format = d.int16()
+	}
+	return d.finish("RowDescription")
+}
+
+// backendMessages creates the struct each backend message type other than
+// authentication decodes into
+var backendMessages = map[MessageType]func() Message{
+	BackendKeyData:           func() Message { return &BackendKeyDataMessage{} },
+	BindComplete:             func() Message { return &BindCompleteMessage{} },
+	CloseComplete:            func() Message { return &CloseCompleteMessage{} },
+	CommandComplete:          func() Message { return &CommandCompleteMessage{} },
+	CopyInResponse:           func() Message { return &CopyResponseMessage{Type: CopyInResponse} },
+	CopyOutResponse:          func() Message { return &CopyResponseMessage{Type: CopyOutResponse} },
+	CopyBothResponse:         func() Message { return &CopyResponseMessage{Type: CopyBothResponse} },
+	CopyData:                 func() Message { return &CopyDataMessage{} },
+	CopyDone:                 func() Message { return &CopyDoneMessage{} },
+	DataRow:                  func() Message { return &DataRowMessage{} },
+	EmptyQueryResponse:       func() Message { return &EmptyQueryResponseMessage{} },
+	ErrorResponse:            func() Message { return &ErrorFieldsMessage{Type: ErrorResponse} },
+	NoticeResponse:           func() Message { return &ErrorFieldsMessage{Type: NoticeResponse} },
+	FunctionCallResponse:     func() Message { return &FunctionCallResponseMessage{} },
+	NegotiateProtocolVersion: func() Message { return &NegotiateProtocolVersionMessage{} },
+	NoData:                   func() Message { return &NoDataMessage{} },
+	NotificationResponse:     func() Message { return &NotificationResponseMessage{} },
+	ParameterDescription:     func() Message { return &ParameterDescriptionMessage{} },
+	ParameterStatus:          func() Message { return &ParameterStatusMessage{} },
+	ParseComplete:            func() Message { return &ParseCompleteMessage{} },
+	PortalSuspended:          func() Message { return &PortalSuspendedMessage{} },
+	ReadyForQuery:            func() Message { return &ReadyForQueryMessage{} },
+	RowDescription:           func() Message { return &RowDescriptionMessage{} },
+}
+
+// DecodeBackend decodes the body of a message sent by the server
+func DecodeBackend(msgType byte, body []byte) (Message, error) {
+	if MessageType(msgType) == AuthenticationOK {
+		return DecodeAuthentication(body)
+	}
+	newMessage, ok := backendMessages[MessageType(msgType)]
+	if !ok {
+		return nil, fmt.Errorf("backend message %q: %w", msgType, ErrUnknownMessageType)
+	}
+	msg := newMessage()
+	return msg, msg.Decode(body)
+}
+
+// DecodeFrontend decodes the body of a typed message sent by the client
+func DecodeFrontend(msgType byte, body []byte) (Message, error) {
+	var msg Message
+	switch MessageType(msgType) {
+	case Bind:
+		msg = &BindMessage{}
+	case Close:
+		msg = &CloseMessage{}
+	case CopyData:
+		msg = &CopyDataMessage{}
+	case CopyDone:
+		msg = &CopyDoneMessage{}
+	case CopyFail:
+		msg = &CopyFailMessage{}
+	case Describe:
+		msg = &DescribeMessage{}
+	case Execute:
+		msg = &ExecuteMessage{}
+	case Flush:
+		msg = &FlushMessage{}
+	case FunctionCall:
+		msg = &FunctionCallMessage{}
+	case Parse:
+		msg = &ParseMessage{}
+	case Password:
+		// Which of the password messages it is depends on the authentication
+		// exchange, the caller decodes the body as the one it expects
+		msg = &SASLResponse{}
+	case Query:
+		msg = &QueryMessage{}
+	case Sync:
+		msg = &SyncMessage{}
+	case Terminate:
+		msg = &TerminateMessage{}
+	default:
+		return nil, fmt.Errorf("frontend message %q: %w", msgType, ErrUnknownMessageType)
+	}
+	return msg, msg.Decode(body)
+}
@@ -0,0 +1,169 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Message is implemented by every typed message. Encode appends the whole
+// message to dst and returns the result; Decode parses a message body, i.e.
+// without the type byte and length.
+type Message interface {
+	Encode(dst []byte) []byte
+	Decode(body []byte) error
+}
+
+// beginMessage appends the type byte and a placeholder length and returns
+// the position of the length; finishMessage fills it in
+func beginMessage(dst []byte, msgType byte) ([]byte, int) {
+	dst = append(dst, msgType)
+	return beginUntypedMessage(dst)
+}
+
+func beginUntypedMessage(dst []byte) ([]byte, int) {
+	start := len(dst)
+	return append(dst, 0, 0, 0, 0), start
+}
+
+func finishMessage(dst []byte, start int) []byte {
+	binary.BigEndian.PutUint32(dst[start:], uint32(len(dst)-start))
+	return dst
+}
+
+func appendInt16(dst []byte, v int16) []byte {
+	return binary.BigEndian.AppendUint16(dst, uint16(v))
+}
+
+func appendInt32(dst []byte, v int32) []byte {
+	return binary.BigEndian.AppendUint32(dst, uint32(v))
+}
+
+func appendCString(dst []byte, s string) []byte {
+	dst = append(dst, s...)
+	return append(dst, 0)
+}
+
+// appendValue appends a length-prefixed value; nil is NULL
+func appendValue(dst []byte, value []byte) []byte {
+	if value == nil {
+		return appendInt32(dst, -1)
+	}
+	dst = appendInt32(dst, int32(len(value)))
+	return append(dst, value...)
+}
+
+// decoder reads fields from a message body. The first error sticks, so a
+// Decode method can read every field and check once at the end.
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf)-d.pos {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) cstring() string {
+	if d.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(d.buf[d.pos:], 0)
+	if end < 0 {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(d.buf[d.pos : d.pos+end])
+	d.pos += end + 1
+	return s
+}
+
+// bytes returns a copy of the next n bytes
+func (d *decoder) bytes(n int) []byte {
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// rest returns a copy of the unread bytes
+func (d *decoder) rest() []byte {
+	return d.bytes(len(d.buf) - d.pos)
+}
+
+// value reads a length-prefixed value; -1 is NULL and returns nil
+func (d *decoder) value() []byte {
+	b := d.valueView()
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// valueView is value without the copy, the result shares the body's memory
+func (d *decoder) valueView() []byte {
+	length := d.int32()
+	if length < -1 && d.err == nil {
+		d.err = fmt.Errorf("invalid value length %d", length)
+	}
+	if length < 0 || d.err != nil {
+		return nil
+	}
+	return d.next(int(length))
+}
+
+// count reads an element count and checks it against the bytes left, each
+// element taking at least minSize bytes
+func (d *decoder) count(minSize int) int {
+	n := int(d.int16())
+	if n < 0 || n*minSize > len(d.buf)-d.pos {
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid element count %d", n)
+		}
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) finish(name string) error {
+	if d.err != nil {
+		return fmt.Errorf("invalid %s message: %w", name, d.err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// CopyBinarySignature starts every file in the PGCOPY binary format
+var CopyBinarySignature = []byte("PGCOPY\n\377\r\n\000")
+
+// Bits 16-31 of the header flags mark format changes a reader must understand
+const copyBinaryCriticalFlags = int32(-1) << 16
+
+// Lengths up to this are allocated up front; longer data is read in chunks so
+// a corrupt length cannot force a huge allocation
+const copyBinaryReadChunk = 64 * 1024
+
+// CopyBinaryWriter produces the PGCOPY binary format used by COPY ... (FORMAT
+// binary). Fields are passed already encoded in their binary wire format.
+type CopyBinaryWriter struct {
+	writer io.Writer
+	buf    []byte
+}
+
+func NewCopyBinaryWriter(writer io.Writer) *CopyBinaryWriter {
+	return &CopyBinaryWriter{writer: writer}
+}
+
+// WriteHeader writes the signature, no flags and an empty header extension
+func (w *CopyBinaryWriter) WriteHeader() error {
+	w.buf = append(w.buf[:0], CopyBinarySignature...)
+	w.buf = appendInt32(w.buf, 0) // flags
+	w.buf = appendInt32(w.buf, 0) // header extension length
+	_, err := w.writer.Write(w.buf)
+	return err
+}
+
+// WriteRow writes one tuple; nil fields are NULL
+func (w *CopyBinaryWriter) WriteRow(fields [][]byte) error {
+	if len(fields) > math.MaxInt16 {
+		return fmt.Errorf("copy tuple of %d fields exceeds the maximum of %d", len(fields), math.MaxInt16)
+	}
+	w.buf = appendInt16(w.buf[:0], int16(len(fields)))
+	for i, field := range fields {
+		if len(field) > math.MaxInt32 {
+			return fmt.Errorf("copy field %d of %d bytes is too long", i, len(field))
+		}
+		w.buf = appendValue(w.buf, field)
+	}
+	_, err := w.writer.Write(w.buf)
+	return err
+}
+
+// WriteTrailer ends the data with a field count of -1
+func (w *CopyBinaryWriter) WriteTrailer() error {
+	_, err := w.writer.Write([]byte{0xff, 0xff})
+	return err
+}
+
+// CopyBinaryReader parses the PGCOPY binary format. Fields are returned in
+// their binary wire format.
+type CopyBinaryReader struct {
+	reader    io.Reader
+	Flags     int32
+	Extension []byte // contents of the header extension area
+}
+
+func NewCopyBinaryReader(reader io.Reader) *CopyBinaryReader {
+	return &CopyBinaryReader{reader: reader}
+}
+
+// ReadHeader checks the signature and reads the flags and header extension
+func (r *CopyBinaryReader) ReadHeader() error {
+	header := make([]byte, len(CopyBinarySignature)+8)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return fmt.Errorf("error reading copy header: %w", err)
+	}
+	if !bytes.Equal(header[:len(CopyBinarySignature)], CopyBinarySignature) {
+		return fmt.Errorf("invalid binary copy signature")
+	}
+
+	r.Flags = int32(binary.BigEndian.Uint32(header[len(CopyBinarySignature):]))
+	if r.Flags&copyBinaryCriticalFlags != 0 {
+		// Such as bit 16, tuples carrying OIDs, which servers no longer write
+		return fmt.Errorf("unsupported binary copy flags %#x", r.Flags)
+	}
+
+	extensionLength := int32(binary.BigEndian.Uint32(header[len(CopyBinarySignature)+4:]))
+	if extensionLength < 0 {
+		return fmt.Errorf("invalid binary copy header extension length %d", extensionLength)
+	}
+	extension, err := readCopyBytes(r.reader, int(extensionLength))
+	if err != nil {
+		return fmt.Errorf("error reading copy header extension: %w", err)
+	}
+	r.Extension = extension
+	return nil
+}
+
+// ReadRow returns the fields of the next tuple, nil for NULL, or io.EOF once
+// the trailer is reached
+func (r *CopyBinaryReader) ReadRow() ([][]byte, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r.reader, buf[:2]); err != nil {
+		return nil, fmt.Errorf("error reading copy tuple: %w", err)
+	}
+	count := int16(binary.BigEndian.Uint16(buf[:2]))
+	if count == -1 {
+		return nil, io.EOF
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("invalid copy tuple field count %d", count)
+	}
+
+	fields := make([][]byte, count)
+	for i := range fields {
+		if _, err := io.ReadFull(r.reader, buf[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("error reading copy field length: %w", err)
+		}
+		length := int32(binary.BigEndian.Uint32(buf[:]))
+		if length == -1 {
+			continue
+		}
+		if length < 0 {
+			return nil, fmt.Errorf("invalid copy field length %d", length)
+		}
+		field, err := readCopyBytes(r.reader, int(length))
+		if err != nil {
+			return nil, fmt.Errorf("error reading copy field: %w", err)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+// readCopyBytes reads n bytes, growing the buffer as they arrive when n is
+// too large to trust
+func readCopyBytes(reader io.Reader, n int) ([]byte, error) {
+	if n <= copyBinaryReadChunk {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(reader, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(copyBinaryReadChunk)
+	if _, err := io.CopyN(&buf, reader, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
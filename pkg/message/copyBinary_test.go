@@ -0,0 +1,131 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCopyBinaryRoundTrip(t *testing.T) {
+	rows := [][][]byte{
+		{[]byte{0, 0, 0, 1}, []byte("alice"), nil},
+		{[]byte{0, 0, 0, 2}, {}, []byte("x")},
+		{},
+	}
+
+	var buf bytes.Buffer
+	w := NewCopyBinaryWriter(&buf)
+	if err := w.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewCopyBinaryReader(&buf)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range rows {
+		got, err := r.ReadRow()
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("row %d: got %q, want %q", i, got, want)
+		}
+	}
+	if _, err := r.ReadRow(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the trailer, got %v", err)
+	}
+}
+
+func TestCopyBinaryTooManyFields(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCopyBinaryWriter(&buf)
+	if err := w.WriteRow(make([][]byte, math.MaxInt16+1)); err == nil {
+		t.Fatal("expected an error for too many fields")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("wrote %d bytes for a rejected row", buf.Len())
+	}
+}
+
+func copyHeader(flags, extensionLength int32, extension ...byte) []byte {
+	header := append([]byte(nil), CopyBinarySignature...)
+	header = binary.BigEndian.AppendUint32(header, uint32(flags))
+	header = binary.BigEndian.AppendUint32(header, uint32(extensionLength))
+	return append(header, extension...)
+}
+
+func TestCopyBinaryHeaderExtension(t *testing.T) {
+	r := NewCopyBinaryReader(bytes.NewReader(copyHeader(0, 3, 'a', 'b', 'c')))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Extension) != "abc" {
+		t.Fatalf("extension = %q", r.Extension)
+	}
+}
+
+func TestCopyBinaryMalformedHeader(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad signature", append([]byte("PGCOPY\n\xff\r\n\x01"), make([]byte, 8)...)},
+		{"truncated signature", CopyBinarySignature[:5]},
+		{"missing flags", CopyBinarySignature},
+		{"critical flag", copyHeader(1<<16, 0)},
+		{"negative extension length", copyHeader(0, -1)},
+		{"short extension", copyHeader(0, 4, 'a')},
+		{"huge extension length", copyHeader(0, math.MaxInt32, 'a', 'b')},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := NewCopyBinaryReader(bytes.NewReader(c.data)).ReadHeader(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestCopyBinaryMalformedRow(t *testing.T) {
+	row := func(count int16, fields ...int32) []byte {
+		data := binary.BigEndian.AppendUint16(nil, uint16(count))
+		for _, length := range fields {
+			data = binary.BigEndian.AppendUint32(data, uint32(length))
+		}
+		return data
+	}
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated count", []byte{0}},
+		{"negative count", row(-2)},
+		{"missing field", row(2, -1)},
+		{"truncated length", row(1)[:4]},
+		{"length below -1", row(1, -2)},
+		{"short field", append(row(1, 4), 'a', 'b')},
+		{"huge field length", append(row(1, math.MaxInt32), 'a', 'b')},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewCopyBinaryReader(bytes.NewReader(c.data)).ReadRow()
+			if err == nil || errors.Is(err, io.EOF) {
+				t.Fatalf("expected a decoding error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package message
+
+import (
+	"sort"
+)
+
+// Frontend message types that have no backend counterpart constant
+const (
+	Bind         MessageType = 'B'
+	Close        MessageType = 'C'
+	Describe     MessageType = 'D'
+	Execute      MessageType = 'E'
+	Flush        MessageType = 'H'
+	FunctionCall MessageType = 'F'
+	Password     MessageType = 'p' // also SASL and GSSAPI responses
+	Sync         MessageType = 'S'
+	Terminate    MessageType = 'X'
+)
+
+// Protocol versions as sent in the startup message, major version in the
+// high 16 bits and minor version in the low 16 bits. 3.2 differs from 3.0
+// only in the variable-length secret key of BackendKeyData and CancelRequest.
+const (
+	ProtocolVersion30 = 3<<16 | 0
+	ProtocolVersion32 = 3<<16 | 2
+)
+
+// MaxSecretKeyLength is the longest cancel key protocol 3.2 allows
+const MaxSecretKeyLength = 256
+
+// Targets of Describe and Close
+const (
+	TargetStatement byte = 'S'
+	TargetPortal    byte = 'P'
+)
+
+type StartupMessage struct {
+	ProtocolVersion int32
+	Parameters      map[string]string // user, database, application_name, ...
+}
+
+func (msg *StartupMessage) Encode(dst []byte) []byte {
+	dst, start := beginUntypedMessage(dst)
+	dst = appendInt32(dst, msg.ProtocolVersion)
+	// Sorted so the message is the same every time
+	names := make([]string, 0, len(msg.Parameters))
+	for name := range msg.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dst = appendCString(dst, name)
+		dst = appendCString(dst, msg.Parameters[name])
+	}
+	dst = append(dst, 0)
+	return finishMessage(dst, start)
+}
+
+func (msg *StartupMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.ProtocolVersion = d.int32()
+	msg.Parameters = make(map[string]string)
+	for d.err == nil {
+		name := d.cstring()
+		if name == "" {
+			break
+		}
+		msg.Parameters[name] = d.cstring()
+	}
+	return d.finish("StartupMessage")
+}
+
+type SSLRequest struct{}
+
+func (msg *SSLRequest) Encode(dst []byte) []byte {
+	dst, start := beginUntypedMessage(dst)
+	dst = appendInt32(dst, sslRequestCode)
+	return finishMessage(dst, start)
+}
+
+func (msg *SSLRequest) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	d.int32()
+	return d.finish("SSLRequest")
+}
+
+type GSSENCRequest struct{}
+
+func (msg *GSSENCRequest) Encode(dst []byte) []byte {
+	dst, start := beginUntypedMessage(dst)
+	dst = appendInt32(dst, gssRequestCode)
+	return finishMessage(dst, start)
+}
+
+func (msg *GSSENCRequest) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	d.int32()
+	return d.finish("GSSENCRequest")
+}
+
+type CancelRequest struct {
+	ProcessID int32
+	SecretKey []byte // as received in BackendKeyData
+}
+
+func (msg *CancelRequest) Encode(dst []byte) []byte {
+	dst, start := beginUntypedMessage(dst)
+	dst = appendInt32(dst, cancelRequestCode)
+	dst = appendInt32(dst, msg.ProcessID)
+	dst = append(dst, msg.SecretKey...)
+	return finishMessage(dst, start)
+}
+
+func (msg *CancelRequest) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	d.int32()
+	msg.ProcessID = d.int32()
+	msg.SecretKey = d.rest()
+	return d.finish("CancelRequest")
+}
+
+// PasswordMessage carries a cleartext or MD5-hashed password
+type PasswordMessage struct {
+	Password string
+}
+
+func (msg *PasswordMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Password))
+	dst = appendCString(dst, msg.Password)
+	return finishMessage(dst, start)
+}
+
+func (msg *PasswordMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Password = d.cstring()
+	return d.finish("PasswordMessage")
+}
+
+type SASLInitialResponse struct {
+	Mechanism string
+	Data      []byte // nil sends a length of -1
+}
+
+func (msg *SASLInitialResponse) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Password))
+	dst = appendCString(dst, msg.Mechanism)
+	dst = appendValue(dst, msg.Data)
+	return finishMessage(dst, start)
+}
+
+func (msg *SASLInitialResponse) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Mechanism = d.cstring()
+	msg.Data = d.value()
+	return d.finish("SASLInitialResponse")
+}
+
+// SASLResponse is also used for GSSAPI and SSPI responses
+type SASLResponse struct {
+	Data []byte
+}
+
+func (msg *SASLResponse) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Password))
+	dst = append(dst, msg.Data...)
+	return finishMessage(dst, start)
+}
+
+func (msg *SASLResponse) Decode(body []byte) error {
+	msg.Data = append([]byte{}, body...)
+	return nil
+}
+
+type QueryMessage struct {
+	SQL string
+}
+
+func (msg *QueryMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Query))
+	dst = appendCString(dst, msg.SQL)
+	return finishMessage(dst, start)
+}
+
+func (msg *QueryMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.SQL = d.cstring()
+	return d.finish("Query")
+}
+
+type ParseMessage struct {
+	Name          string // empty for the unnamed statement
+	SQL           string
+	ParameterOIDs []uint32 // 0 leaves the type to the server
+}
+
+func (msg *ParseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Parse))
+	dst = appendCString(dst, msg.Name)
+	dst = appendCString(dst, msg.SQL)
+	dst = appendInt16(dst, int16(len(msg.ParameterOIDs)))
+	for _, oid := range msg.ParameterOIDs {
+		dst = appendInt32(dst, int32(oid))
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *ParseMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Name = d.cstring()
+	msg.SQL = d.cstring()
+	msg.ParameterOIDs = make([]uint32, d.count(4))
+	for i := range msg.ParameterOIDs {
+		msg.ParameterOIDs[i] = uint32(d.int32())
+	}
+	return d.finish("Parse")
+}
+
+type BindMessage struct {
+	Portal           string // empty for the unnamed portal
+	Statement        string // empty for the unnamed statement
+	ParameterFormats []int16
+	Parameters       [][]byte // nil values are NULL
+	ResultFormats    []int16
+}
+
+func (msg *BindMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Bind))
+	dst = appendCString(dst, msg.Portal)
+	dst = appendCString(dst, msg.Statement)
+	dst = appendInt16(dst, int16(len(msg.ParameterFormats)))
+	for _, format := range msg.ParameterFormats {
+		dst = appendInt16(dst, format)
+	}
+	dst = appendInt16(dst, int16(len(msg.Parameters)))
+	for _, value := range msg.Parameters {
+		dst = appendValue(dst, value)
+	}
+	dst = appendInt16(dst, int16(len(msg.ResultFormats)))
+	for _, format := range msg.ResultFormats {
+		dst = appendInt16(dst, format)
+	}
+	return finishMessage(dst, start)
+}
+
+func (msg *BindMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Portal = d.cstring()
+	msg.Statement = d.cstring()
+	msg.ParameterFormats = make([]int16, d.count(2))
+	for i := range msg.ParameterFormats {
+		msg.ParameterFormats[i] = d.int16()
+	}
+	msg.Parameters = make([][]byte, d.count(4))
+	for i := range msg.Parameters {
+		msg.Parameters[i] = d.value()
+	}
+	msg.ResultFormats = make([]int16, d.count(2))
+	for i := range msg.ResultFormats {
+		msg.ResultFormats[i] = d.int16()
+	}
+	return d.finish("Bind")
+}
+
+type DescribeMessage struct {
+	Target byte // TargetStatement or TargetPortal
+	Name   string
+}
+
+func (msg *DescribeMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Describe))
+	dst = append(dst, msg.Target)
+	dst = appendCString(dst, msg.Name)
+	return finishMessage(dst, start)
+}
+
+func (msg *DescribeMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Target = d.byte()
+	msg.Name = d.cstring()
+	return d.finish("Describe")
+}
+
+type ExecuteMessage struct {
+	Portal  string
+	MaxRows int32 // 0 fetches every row
+}
+
+func (msg *ExecuteMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Execute))
+	dst = appendCString(dst, msg.Portal)
+	dst = appendInt32(dst, msg.MaxRows)
+	return finishMessage(dst, start)
+}
+
+func (msg *ExecuteMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Portal = d.cstring()
+	msg.MaxRows = d.int32()
+	return d.finish("Execute")
+}
+
+type CloseMessage struct {
+	Target byte // TargetStatement or TargetPortal
+	Name   string
+}
+
+func (msg *CloseMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Close))
+	dst = append(dst, msg.Target)
+	dst = appendCString(dst, msg.Name)
+	return finishMessage(dst, start)
+}
+
+func (msg *CloseMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Target = d.byte()
+	msg.Name = d.cstring()
+	return d.finish("Close")
+}
+
+type FlushMessage struct{}
+
+func (msg *FlushMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Flush))
+	return finishMessage(dst, start)
+}
+
+func (msg *FlushMessage) Decode(body []byte) error { return nil }
+
+type SyncMessage struct{}
+
+func (msg *SyncMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Sync))
+	return finishMessage(dst, start)
+}
+
+func (msg *SyncMessage) Decode(body []byte) error { return nil }
+
+type TerminateMessage struct{}
+
+func (msg *TerminateMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(Terminate))
+	return finishMessage(dst, start)
+}
+
+func (msg *TerminateMessage) Decode(body []byte) error { return nil }
+
+type CopyFailMessage struct {
+	Reason string
+}
+
+func (msg *CopyFailMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(CopyFail))
+	dst = appendCString(dst, msg.Reason)
+	return finishMessage(dst, start)
+}
+
+func (msg *CopyFailMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.Reason = d.cstring()
+	return d.finish("CopyFail")
+}
+
+type FunctionCallMessage struct {
+	FunctionOID     uint32
+	ArgumentFormats []int16
+	Arguments       [][]byte // nil values are NULL
+	ResultFormat    int16
+}
+
+func (msg *FunctionCallMessage) Encode(dst []byte) []byte {
+	dst, start := beginMessage(dst, byte(FunctionCall))
+	dst = appendInt32(dst, int32(msg.FunctionOID))
+	dst = appendInt16(dst, int16(len(msg.ArgumentFormats)))
+	for _, format := range msg.ArgumentFormats {
+		dst = appendInt16(dst, format)
+	}
+	dst = appendInt16(dst, int16(len(msg.Arguments)))
+	for _, value := range msg.Arguments {
+		dst = appendValue(dst, value)
+	}
+	dst = appendInt16(dst, msg.ResultFormat)
+	return finishMessage(dst, start)
+}
+
+func (msg *FunctionCallMessage) Decode(body []byte) error {
+	d := &decoder{buf: body}
+	msg.FunctionOID = uint32(d.int32())
+	msg.ArgumentFormats = make([]int16, d.count(2))
+	for i := range msg.ArgumentFormats {
+		msg.ArgumentFormats[i] = d.int16()
+	}
+	msg.Arguments = make([][]byte, d.count(4))
+	for i := range msg.Arguments {
+		msg.Arguments[i] = d.value()
+	}
+	msg.ResultFormat = d.int16()
+	return d.finish("FunctionCall")
+}
@@ -30,41 +30,69 @@ const (
 	RowDescription       MessageType = 'T'
 	Query                MessageType = 'Q'
 	Parse                MessageType = 'P'
+	CopyInResponse       MessageType = 'G'
+	CopyOutResponse      MessageType = 'H'
+	CopyBothResponse     MessageType = 'W'
+	CopyData             MessageType = 'd'
+	CopyDone             MessageType = 'c'
+	CopyFail             MessageType = 'f'
 )
 
+// InitializeHandlers returns a handler for every backend message type of the
+// protocol. Each decodes the body into the type's message struct, e.g. a
+// *DataRowMessage for DataRow.
 func InitializeHandlers() map[byte]ResponseHandler {
 	handlers := make(map[byte]ResponseHandler)
-
+	handlers[byte(AuthenticationOK)] = decodeBackendHandler
+	for msgType := range backendMessages {
+		handlers[byte(msgType)] = decodeBackendHandler
+	}
 	return handlers
 }
 
+func decodeBackendHandler(messageType MessageType, data []byte) (any, error) {
+	msg, err := DecodeBackend(byte(messageType), data)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ProcessErrorResponse reads the fields of an ErrorResponse or NoticeResponse.
+//
+// Deprecated: decode the body with DecodeBackend, which returns an
+// *ErrorFieldsMessage.
 func ProcessErrorResponse(reader *PgReader, length int32) (map[byte]string, error) {
-    fields := make(map[byte]string)
-    bytesRemaining := length - 4 // length includes itself
-
-    for bytesRemaining > 0 {
-        fieldType, err := reader.ReadByte()
-        if err != nil {
-            return nil, fmt.Errorf("error reading error field type: %w", err)
-        }
-
-        // Terminator
-        if fieldType == 0 {
-            break
-        }
-
-        str, err := reader.ReadCString()
-        if err != nil {
-            return nil, fmt.Errorf("error reading error field string: %w", err)
-        }
-
-        fields[fieldType] = str
-        bytesRemaining -= int32(1 + len(str) + 1)
-    }
-
-    return fields, nil
+	fields := make(map[byte]string)
+	bytesRemaining := length - 4 // length includes itself
+
+	for bytesRemaining > 0 {
+		fieldType, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("error reading error field type: %w", err)
+		}
+
+		// Terminator
+		if fieldType == 0 {
+			break
+		}
+
+		str, err := reader.ReadCString()
+		if err != nil {
+			return nil, fmt.Errorf("error reading error field string: %w", err)
+		}
+
+		fields[fieldType] = str
+		bytesRemaining -= int32(1 + len(str) + 1)
+	}
+
+	return fields, nil
 }
 
+// ProcessReadyForQuery reads the transaction status of a ReadyForQuery.
+//
+// Deprecated: decode the body with DecodeBackend, which returns a
+// *ReadyForQueryMessage.
 func ProcessReadyForQuery(reader *PgReader) (string, error) {
 	status, err := reader.ReadByte()
 	if err != nil {
@@ -73,19 +101,28 @@ func ProcessReadyForQuery(reader *PgReader) (string, error) {
 	return string(status), nil
 }
 
+// ProcessBackendKeyData reads the process ID and secret key of a
+// BackendKeyData.
+//
+// Deprecated: it only reads the 4-byte keys of protocol 3.0. Decode the body
+// with DecodeBackend, which returns a *BackendKeyDataMessage.
 func ProcessBackendKeyData(reader *PgReader) (int32, int32, error) {
 	pid, err := reader.ReadInt32()
 	if err != nil {
-		return 0, 0, fmt.Errorf("error reading backend key data: %w", err)
+		return 0, 0, fmt.Errorf("error reading process ID: %w", err)
 	}
 	key, err := reader.ReadInt32()
 	if err != nil {
-		return 0, 0, fmt.Errorf("error reading process ID: %w", err)
+		return 0, 0, fmt.Errorf("error reading secret key: %w", err)
 	}
 
 	return pid, key, nil
 }
 
+// ProcessParameterStatus reads the name and value of a ParameterStatus.
+//
+// Deprecated: decode the body with DecodeBackend, which returns a
+// *ParameterStatusMessage.
 func ProcessParameterStatus(reader *PgReader) (string, string, error) {
 	param, err := reader.ReadCString()
 	if err != nil {
@@ -100,6 +137,28 @@ func ProcessParameterStatus(reader *PgReader) (string, string, error) {
 	return param, value, nil
 }
 
+// ProcessNotificationResponse reads the process ID, channel and payload of a
+// NotificationResponse.
+//
+// Deprecated: decode the body with DecodeBackend, which returns a
+// *NotificationResponseMessage.
+func ProcessNotificationResponse(reader *PgReader) (int32, string, string, error) {
+	pid, err := reader.ReadInt32()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("error reading notifying process ID: %w", err)
+	}
+	channel, err := reader.ReadCString()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("error reading notification channel: %w", err)
+	}
+	payload, err := reader.ReadCString()
+	if err != nil {
+		return 0, "", "", fmt.Errorf("error reading notification payload: %w", err)
+	}
+
+	return pid, channel, payload, nil
+}
+
 func (mt MessageType) String() string {
 	switch mt {
 	case AuthenticationOK:
@@ -142,6 +201,57 @@ func (mt MessageType) String() string {
 		return "Query"
 	case Parse:
 		return "Parse"
+	case CopyInResponse:
+		return "CopyInResponse"
+	case CopyOutResponse:
+		return "CopyOutResponse"
+	case CopyBothResponse:
+		return "CopyBothResponse"
+	case CopyData:
+		return "CopyData"
+	case CopyDone:
+		return "CopyDone"
+	case CopyFail:
+		return "CopyFail"
+	case NegotiateProtocolVersion:
+		return "NegotiateProtocolVersion"
+	default:
+		return fmt.Sprintf("Unknown(%c)", mt)
+	}
+}
+
+// FrontendString names a message sent by the client; several share a type
+// byte with backend messages of a different meaning
+func (mt MessageType) FrontendString() string {
+	switch mt {
+	case 'Q':
+		return "Query"
+	case 'P':
+		return "Parse"
+	case 'B':
+		return "Bind"
+	case 'D':
+		return "Describe"
+	case 'E':
+		return "Execute"
+	case 'C':
+		return "Close"
+	case 'S':
+		return "Sync"
+	case 'H':
+		return "Flush"
+	case 'X':
+		return "Terminate"
+	case 'd':
+		return "CopyData"
+	case 'c':
+		return "CopyDone"
+	case 'f':
+		return "CopyFail"
+	case 'p':
+		return "PasswordMessage"
+	case 'F':
+		return "FunctionCall"
 	default:
 		return fmt.Sprintf("Unknown(%c)", mt)
 	}
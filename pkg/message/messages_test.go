@@ -0,0 +1,299 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type codecCase struct {
+	name     string
+	msg      Message
+	frontend bool
+	// minValid is the shortest prefix of the body that may still decode, for
+	// bodies ending in data of any length; 0 means every prefix must fail
+	minValid int
+}
+
+var codecCases = []codecCase{
+	// Frontend
+	{name: "StartupMessage", frontend: true, msg: &StartupMessage{ProtocolVersion: ProtocolVersion30, Parameters: map[string]string{"user": "app", "database": "db"}}},
+	{name: "StartupMessage 3.2", frontend: true, msg: &StartupMessage{ProtocolVersion: ProtocolVersion32, Parameters: map[string]string{"user": "app", "_pq_.option": "on"}}},
+	{name: "SSLRequest", frontend: true, msg: &SSLRequest{}},
+	{name: "GSSENCRequest", frontend: true, msg: &GSSENCRequest{}},
+	{name: "CancelRequest", frontend: true, msg: &CancelRequest{ProcessID: 42, SecretKey: []byte{1, 2, 3, 4}}, minValid: 8},
+	{name: "PasswordMessage", frontend: true, msg: &PasswordMessage{Password: "secret"}},
+	{name: "SASLInitialResponse", frontend: true, msg: &SASLInitialResponse{Mechanism: "SCRAM-SHA-256", Data: []byte("n,,n=,r=nonce")}},
+	{name: "SASLInitialResponse without data", frontend: true, msg: &SASLInitialResponse{Mechanism: "SCRAM-SHA-256"}},
+	{name: "SASLResponse", frontend: true, msg: &SASLResponse{Data: []byte("c=biws,r=nonce,p=proof")}, minValid: -1},
+	{name: "QueryMessage", frontend: true, msg: &QueryMessage{SQL: "select 1"}},
+	{name: "ParseMessage", frontend: true, msg: &ParseMessage{Name: "s1", SQL: "select $1, $2", ParameterOIDs: []uint32{23, 0}}},
+	{name: "BindMessage", frontend: true, msg: &BindMessage{Portal: "p1", Statement: "s1", ParameterFormats: []int16{0, 1}, Parameters: [][]byte{[]byte("1"), nil, {}}, ResultFormats: []int16{1}}},
+	{name: "DescribeMessage", frontend: true, msg: &DescribeMessage{Target: TargetStatement, Name: "s1"}},
+	{name: "ExecuteMessage", frontend: true, msg: &ExecuteMessage{Portal: "p1", MaxRows: 100}},
+	{name: "CloseMessage", frontend: true, msg: &CloseMessage{Target: TargetPortal, Name: "p1"}},
+	{name: "FlushMessage", frontend: true, msg: &FlushMessage{}},
+	{name: "SyncMessage", frontend: true, msg: &SyncMessage{}},
+	{name: "TerminateMessage", frontend: true, msg: &TerminateMessage{}},
+	{name: "CopyFailMessage", frontend: true, msg: &CopyFailMessage{Reason: "cancelled"}},
+	{name: "FunctionCallMessage", frontend: true, msg: &FunctionCallMessage{FunctionOID: 1598, ArgumentFormats: []int16{1}, Arguments: [][]byte{{0, 0, 0, 1}, nil}, ResultFormat: 1}},
+
+	// Backend
+	{name: "AuthenticationOk", msg: &AuthenticationOk{}},
+	{name: "AuthenticationKerberosV5", msg: &AuthenticationKerberosV5{}},
+	{name: "AuthenticationCleartextPassword", msg: &AuthenticationCleartextPassword{}},
+	{name: "AuthenticationMD5Password", msg: &AuthenticationMD5Password{Salt: [4]byte{1, 2, 3, 4}}},
+	{name: "AuthenticationGSS", msg: &AuthenticationGSS{}},
+	{name: "AuthenticationGSSContinue", msg: &AuthenticationGSSContinue{Data: []byte("token")}, minValid: 4},
+	{name: "AuthenticationSSPI", msg: &AuthenticationSSPI{}},
+	{name: "AuthenticationSASL", msg: &AuthenticationSASL{Mechanisms: []string{"SCRAM-SHA-256-PLUS", "SCRAM-SHA-256"}}},
+	{name: "AuthenticationSASLContinue", msg: &AuthenticationSASLContinue{Data: []byte("r=nonce,s=salt,i=4096")}, minValid: 4},
+	{name: "AuthenticationSASLFinal", msg: &AuthenticationSASLFinal{Data: []byte("v=signature")}, minValid: 4},
+	{name: "BackendKeyData", msg: &BackendKeyDataMessage{ProcessID: 42, SecretKey: []byte{0, 0, 0, 7}}},
+	{name: "BackendKeyData 3.2", msg: &BackendKeyDataMessage{ProcessID: 42, SecretKey: bytes.Repeat([]byte{7}, 32)}, minValid: 8},
+	{name: "BindComplete", msg: &BindCompleteMessage{}},
+	{name: "CloseComplete", msg: &CloseCompleteMessage{}},
+	{name: "CommandComplete", msg: &CommandCompleteMessage{Tag: "INSERT 0 1"}},
+	{name: "CopyInResponse", msg: &CopyResponseMessage{Type: CopyInResponse, Format: 0, ColumnFormats: []int16{0, 0}}},
+	{name: "CopyOutResponse", msg: &CopyResponseMessage{Type: CopyOutResponse, Format: 1, ColumnFormats: []int16{1}}},
+	{name: "CopyBothResponse", msg: &CopyResponseMessage{Type: CopyBothResponse, Format: 0, ColumnFormats: []int16{0}}},
+	{name: "CopyData", msg: &CopyDataMessage{Data: []byte("1\tone\n")}, minValid: -1},
+	{name: "CopyDone", msg: &CopyDoneMessage{}},
+	{name: "DataRow", msg: &DataRowMessage{Values: [][]byte{[]byte("1"), nil, {}, []byte("alice")}}},
+	{name: "EmptyQueryResponse", msg: &EmptyQueryResponseMessage{}},
+	{name: "ErrorResponse", msg: &ErrorFieldsMessage{Type: ErrorResponse, Fields: map[byte]string{'S': "ERROR", 'C': "42P01", 'M': "relation does not exist"}}},
+	{name: "NoticeResponse", msg: &ErrorFieldsMessage{Type: NoticeResponse, Fields: map[byte]string{'S': "NOTICE", 'M': "hello"}}},
+	{name: "FunctionCallResponse", msg: &FunctionCallResponseMessage{Result: []byte{0, 0, 0, 1}}},
+	{name: "FunctionCallResponse NULL", msg: &FunctionCallResponseMessage{}},
+	{name: "NegotiateProtocolVersion", msg: &NegotiateProtocolVersionMessage{NewestMinorVersion: 0, UnrecognizedOptions: []string{"_pq_.option"}}},
+	{name: "NoData", msg: &NoDataMessage{}},
+	{name: "NotificationResponse", msg: &NotificationResponseMessage{ProcessID: 42, Channel: "jobs", Payload: "hello"}},
+	{name: "ParameterDescription", msg: &ParameterDescriptionMessage{ParameterOIDs: []uint32{23, 25}}},
+	{name: "ParameterStatus", msg: &ParameterStatusMessage{Name: "TimeZone", Value: "UTC"}},
+	{name: "ParseComplete", msg: &ParseCompleteMessage{}},
+	{name: "PortalSuspended", msg: &PortalSuspendedMessage{}},
+	{name: "ReadyForQuery", msg: &ReadyForQueryMessage{TxStatus: 'T'}},
+	{name: "RowDescription", msg: &RowDescriptionMessage{Fields: []FieldDescription{
+		{Name: "id", TableOID: 16384, AttributeNumber: 1, DataTypeOID: 23, DataTypeSize: 4, TypeModifier: -1},
+		{Name: "data", DataTypeOID: 17, DataTypeSize: -1, TypeModifier: -1, Format: 1},
+	}}},
+}
+
+// splitFrame checks the length of an encoded message and returns its type,
+// which is 0 for an untyped message, and its body
+func splitFrame(t *testing.T, frame []byte, untyped bool) (byte, []byte) {
+	t.Helper()
+	header := 5
+	if untyped {
+		header = 4
+	}
+	if len(frame) < header {
+		t.Fatalf("frame of %d bytes", len(frame))
+	}
+	if length := binary.BigEndian.Uint32(frame[header-4:]); int(length) != len(frame)-header+4 {
+		t.Fatalf("length %d for a frame of %d bytes", length, len(frame))
+	}
+	if untyped {
+		return 0, frame[header:]
+	}
+	return frame[0], frame[header:]
+}
+
+func isUntyped(msg Message) bool {
+	switch msg.(type) {
+	case *StartupMessage, *SSLRequest, *GSSENCRequest, *CancelRequest:
+		return true
+	}
+	return false
+}
+
+// decodeLike decodes body into a new message of the same kind as msg
+func decodeLike(msg Message, msgType byte, body []byte, frontend bool) (Message, error) {
+	if !frontend {
+		return DecodeBackend(msgType, body)
+	}
+	decoded := reflect.New(reflect.TypeOf(msg).Elem()).Interface().(Message)
+	return decoded, decoded.Decode(body)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range codecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			frame := tc.msg.Encode([]byte("prefix"))
+			if !bytes.HasPrefix(frame, []byte("prefix")) {
+				t.Fatal("Encode overwrote dst")
+			}
+			frame = frame[len("prefix"):]
+			msgType, body := splitFrame(t, frame, isUntyped(tc.msg))
+
+			decoded, err := decodeLike(tc.msg, msgType, body, tc.frontend)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tc.msg) {
+				t.Fatalf("decoded %#v, want %#v", decoded, tc.msg)
+			}
+			if again := decoded.Encode(nil); !bytes.Equal(again, frame) {
+				t.Fatalf("encoded again as %q, want %q", again, frame)
+			}
+		})
+	}
+}
+
+func TestDecodeFrontendTypes(t *testing.T) {
+	for _, tc := range codecCases {
+		if !tc.frontend || isUntyped(tc.msg) {
+			continue
+		}
+		frame := tc.msg.Encode(nil)
+		decoded, err := DecodeFrontend(frame[0], frame[5:])
+		if MessageType(frame[0]) == Password {
+			// Password messages can only be told apart by the exchange
+			if _, ok := decoded.(*SASLResponse); !ok || err != nil {
+				t.Errorf("%s: decoded as %T, %v", tc.name, decoded, err)
+			}
+			continue
+		}
+		if err != nil || reflect.TypeOf(decoded) != reflect.TypeOf(tc.msg) {
+			t.Errorf("%s: decoded as %T, %v", tc.name, decoded, err)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, tc := range codecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.minValid < 0 {
+				t.Skip("any body is valid")
+			}
+			frame := tc.msg.Encode(nil)
+			msgType, body := splitFrame(t, frame, isUntyped(tc.msg))
+			minValid := tc.minValid
+			if minValid == 0 {
+				minValid = len(body)
+			}
+			for n := 0; n < minValid; n++ {
+				// A copy of exactly n bytes, so reading past it is caught
+				truncated := append([]byte(nil), body[:n]...)
+				if _, err := decodeLike(tc.msg, msgType, truncated, tc.frontend); err == nil {
+					t.Errorf("decoded a body cut to %d of %d bytes", n, len(body))
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	int16s := func(values ...int16) []byte {
+		var b []byte
+		for _, v := range values {
+			b = appendInt16(b, v)
+		}
+		return b
+	}
+	int32s := func(values ...int32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = appendInt32(b, v)
+		}
+		return b
+	}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name     string
+		msgType  MessageType
+		body     []byte
+		frontend bool
+	}{
+		{"DataRow negative count", DataRow, int16s(-1), false},
+		{"DataRow count beyond body", DataRow, int16s(0x7fff), false},
+		{"DataRow missing value", DataRow, join(int16s(2), int32s(1), []byte("x")), false},
+		{"DataRow value length below -1", DataRow, join(int16s(1), int32s(-2)), false},
+		{"DataRow value past the end", DataRow, join(int16s(1), int32s(100), []byte("x")), false},
+		{"RowDescription short field", RowDescription, join(int16s(1), []byte("id\x00"), int32s(0)), false},
+		{"RowDescription name without terminator", RowDescription, join(int16s(1), bytes.Repeat([]byte("x"), 20)), false},
+		{"ParameterDescription missing OID", ParameterDescription, join(int16s(2), int32s(23)), false},
+		{"BackendKeyData short key", BackendKeyData, join(int32s(42), []byte{1, 2, 3}), false},
+		{"BackendKeyData long key", BackendKeyData, join(int32s(42), make([]byte, MaxSecretKeyLength+1)), false},
+		{"Authentication unknown code", AuthenticationOK, int32s(99), false},
+		{"AuthenticationMD5Password short salt", AuthenticationOK, join(int32s(AuthMD5Password), []byte{1, 2, 3}), false},
+		{"AuthenticationSASL without terminator", AuthenticationOK, join(int32s(AuthSASL), []byte("SCRAM-SHA-256")), false},
+		{"NegotiateProtocolVersion negative count", NegotiateProtocolVersion, int32s(0, -1), false},
+		{"NegotiateProtocolVersion count beyond body", NegotiateProtocolVersion, int32s(0, 1000), false},
+		{"ErrorResponse without terminator", ErrorResponse, []byte("SERROR"), false},
+		{"CommandComplete without terminator", CommandComplete, []byte("SELECT 1"), false},
+		{"ReadyForQuery empty", ReadyForQuery, nil, false},
+		{"CopyOutResponse count beyond body", CopyOutResponse, join([]byte{0}, int16s(3), int16s(0)), false},
+		{"Bind value length below -1", Bind, join([]byte("\x00\x00"), int16s(0), int16s(1), int32s(-5), int16s(0)), true},
+		{"Bind negative parameter count", Bind, join([]byte("\x00\x00"), int16s(0), int16s(-1)), true},
+		{"Parse count beyond body", Parse, join([]byte("\x00select 1\x00"), int16s(5)), true},
+		{"FunctionCall missing result format", FunctionCall, join(int32s(1598), int16s(0), int16s(0)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode := DecodeBackend
+			if tt.frontend {
+				decode = DecodeFrontend
+			}
+			if _, err := decode(byte(tt.msgType), tt.body); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownType(t *testing.T) {
+	if _, err := DecodeBackend('?', nil); !errors.Is(err, ErrUnknownMessageType) {
+		t.Errorf("backend: %v", err)
+	}
+	if _, err := DecodeFrontend('?', nil); !errors.Is(err, ErrUnknownMessageType) {
+		t.Errorf("frontend: %v", err)
+	}
+}
+
+func TestDataRowValuesShareBody(t *testing.T) {
+	body := (&DataRowMessage{Values: [][]byte{[]byte("abc")}}).Encode(nil)[5:]
+	var msg DataRowMessage
+	if err := msg.Decode(body); err != nil {
+		t.Fatal(err)
+	}
+	body[len(body)-1] = 'x'
+	if string(msg.Values[0]) != "abx" {
+		t.Errorf("value %q does not share the body", msg.Values[0])
+	}
+}
+
+func TestProcessFunctions(t *testing.T) {
+	var data []byte
+	data = (&ErrorFieldsMessage{Type: ErrorResponse, Fields: map[byte]string{'C': "42P01", 'M': "no table"}}).Encode(data)
+	data = (&ReadyForQueryMessage{TxStatus: 'T'}).Encode(data)
+	data = (&BackendKeyDataMessage{ProcessID: 42, SecretKey: []byte{0, 0, 0, 7}}).Encode(data)
+	data = (&ParameterStatusMessage{Name: "TimeZone", Value: "UTC"}).Encode(data)
+	data = (&NotificationResponseMessage{ProcessID: 42, Channel: "jobs", Payload: "1"}).Encode(data)
+	reader := NewPgReader(bytes.NewReader(data))
+
+	_, length, _ := reader.ReadMessage()
+	fields, err := ProcessErrorResponse(reader, length)
+	if err != nil || !reflect.DeepEqual(fields, map[byte]string{'C': "42P01", 'M': "no table"}) {
+		t.Fatalf("ProcessErrorResponse = %v, %v", fields, err)
+	}
+	reader.ReadMessage()
+	if status, err := ProcessReadyForQuery(reader); err != nil || status != "T" {
+		t.Fatalf("ProcessReadyForQuery = %q, %v", status, err)
+	}
+	reader.ReadMessage()
+	if pid, key, err := ProcessBackendKeyData(reader); err != nil || pid != 42 || key != 7 {
+		t.Fatalf("ProcessBackendKeyData = %d, %d, %v", pid, key, err)
+	}
+	reader.ReadMessage()
+	if name, value, err := ProcessParameterStatus(reader); err != nil || name != "TimeZone" || value != "UTC" {
+		t.Fatalf("ProcessParameterStatus = %q, %q, %v", name, value, err)
+	}
+	reader.ReadMessage()
+	if pid, channel, payload, err := ProcessNotificationResponse(reader); err != nil || pid != 42 || channel != "jobs" || payload != "1" {
+		t.Fatalf("ProcessNotificationResponse = %d, %q, %q, %v", pid, channel, payload, err)
+	}
+}
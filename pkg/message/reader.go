@@ -1,83 +1,229 @@
 package message
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"slices"
 )
 
+// DefaultMaxMessageSize is the largest message a PgReader accepts unless
+// configured otherwise. Rows with larger values need SetMaxMessageSize.
+const DefaultMaxMessageSize = 64 << 20
+
+// Message buffers up to this size are kept for the next message
+const retainedBufferSize = 1 << 20
+
+// Bodies longer than this are read in growing chunks, so a bogus length costs
+// no more memory than the bytes that actually arrive
+const messageReadChunk = 64 * 1024
+
+// PgReader reads length-prefixed messages. ReadMessage pulls a whole message
+// into a reusable buffer and the other Read methods then decode its fields,
+// failing instead of running past its end.
 type PgReader struct {
-	reader io.Reader
+	reader         *bufio.Reader
+	maxMessageSize int
+	buf            []byte // body of the current message
+	pos            int
+	inMessage      bool
 }
 
 func NewPgReader(reader io.Reader) *PgReader {
-	return &PgReader{reader: reader}
+	return &PgReader{
+		reader:         bufio.NewReaderSize(reader, 8192),
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+// SetMaxMessageSize sets the largest message body, in bytes, ReadMessage
+// accepts; a non-positive size restores the default
+func (r *PgReader) SetMaxMessageSize(size int) {
+	if size <= 0 {
+		size = DefaultMaxMessageSize
+	}
+	r.maxMessageSize = size
+}
+
+// WaitMessage blocks until the next message starts to arrive
+func (r *PgReader) WaitMessage() error {
+	_, err := r.reader.Peek(1)
+	return err
+}
+
+// ReadMessage reads the next message, discarding what is left of the current
+// one. It returns the message type and the length field, which counts
+// itself but not the type byte.
+func (r *PgReader) ReadMessage() (byte, int32, error) {
+	r.inMessage = false
+
+	var header [5]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		return 0, 0, err
+	}
+	length := int32(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 {
+		return 0, 0, fmt.Errorf("invalid length %d for message type %s", length, MessageType(header[0]))
+	}
+	size := int(length) - 4
+	if size > r.maxMessageSize {
+		return 0, 0, fmt.Errorf("message type %s of %d bytes exceeds the maximum of %d", MessageType(header[0]), size, r.maxMessageSize)
+	}
+
+	if err := r.readBody(size); err != nil {
+		return 0, 0, fmt.Errorf("error reading message body: %w", err)
+	}
+	r.pos = 0
+	r.inMessage = true
+	return header[0], length, nil
+}
+
+func (r *PgReader) readBody(size int) error {
+	if cap(r.buf) > retainedBufferSize {
+		r.buf = nil
+	}
+	if size <= cap(r.buf) || size <= messageReadChunk {
+		if cap(r.buf) < size {
+			r.buf = make([]byte, size, max(size, 512))
+		}
+		r.buf = r.buf[:size]
+		_, err := io.ReadFull(r.reader, r.buf)
+		return err
+	}
+
+	r.buf = r.buf[:0]
+	for len(r.buf) < size {
+		start := len(r.buf)
+		chunk := min(size-start, max(start, messageReadChunk))
+		r.buf = slices.Grow(r.buf, chunk)[:start+chunk]
+		if _, err := io.ReadFull(r.reader, r.buf[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Remaining returns the number of unread bytes of the current message
+func (r *PgReader) Remaining() int {
+	if !r.inMessage {
+		return 0
+	}
+	return len(r.buf) - r.pos
+}
+
+// next returns the next n bytes of the current message, or of the stream
+// when no message has been read
+func (r *PgReader) next(n int) ([]byte, error) {
+	if !r.inMessage {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r.reader, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if n > len(r.buf)-r.pos {
+		return nil, fmt.Errorf("read of %d bytes past the end of the message: %w", n, io.ErrUnexpectedEOF)
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
 }
 
 func (r *PgReader) Read(p []byte) (n int, err error) {
-	n, err = r.reader.Read(p)
-	if err != nil {
-		return n, err
+	if !r.inMessage {
+		return r.reader.Read(p)
+	}
+	if r.pos >= len(r.buf) {
+		return 0, io.EOF
 	}
+	n = copy(p, r.buf[r.pos:])
+	r.pos += n
 	return n, nil
 }
 
 func (r *PgReader) ReadByte() (byte, error) {
-	var buf [1]byte
-	_, err := r.reader.Read(buf[:])
+	b, err := r.next(1)
 	if err != nil {
 		return 0, err
 	}
-	return buf[0], nil
+	return b[0], nil
 }
 
 func (r *PgReader) ReadInt32() (int32, error) {
-	var buf [4]byte
-	n, err := r.reader.Read(buf[:])
+	b, err := r.next(4)
 	if err != nil {
 		return 0, err
 	}
-	return int32(binary.BigEndian.Uint32(buf[:n])), nil
+	return int32(binary.BigEndian.Uint32(b)), nil
 }
 
 func (r *PgReader) ReadInt16() (int16, error) {
-	var buf [2]byte
-	n, err := r.reader.Read(buf[:])
+	b, err := r.next(2)
 	if err != nil {
 		return 0, err
 	}
-	// return int16(buf[0])<<8 | int16(buf[1]), nil - this is a more efficient way to read int16
-	return int16(binary.BigEndian.Uint16(buf[:n])), nil
+	return int16(binary.BigEndian.Uint16(b)), nil
 }
 
 func (r *PgReader) ReadCString() (string, error) {
-	var buf bytes.Buffer
-	one := make([]byte, 1)
-
-	for {
-		_, err := r.reader.Read(one)
+	if !r.inMessage {
+		s, err := r.reader.ReadString(0)
 		if err != nil {
 			return "", err
 		}
-		if one[0] == 0 {
-			break
-		}
-		buf.WriteByte(one[0])
+		return s[:len(s)-1], nil
+	}
+
+	end := bytes.IndexByte(r.buf[r.pos:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string in message: %w", io.ErrUnexpectedEOF)
 	}
-	return buf.String(), nil
+	s := string(r.buf[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s, nil
 }
 
+// ReadNBytes returns a copy of the next n bytes. Fewer are returned if the
+// message or stream ends first.
 func (conn *PgReader) ReadNBytes(n int) []byte {
+	if n < 0 {
+		return nil
+	}
+	if conn.inMessage {
+		n = min(n, len(conn.buf)-conn.pos)
+	}
 	b := make([]byte, n)
-	io.ReadFull(conn, b[:])
-	return b
+	read, _ := io.ReadFull(conn, b)
+	return b[:read]
 }
 
 func (reader *PgReader) SkipN(n int32) error {
-	_, err := io.CopyN(io.Discard, reader, int64(n))
+	if reader.inMessage {
+		if int(n) > len(reader.buf)-reader.pos || n < 0 {
+			return fmt.Errorf("error skipping %d bytes: %w", n, io.ErrUnexpectedEOF)
+		}
+		reader.pos += int(n)
+		return nil
+	}
+	_, err := io.CopyN(io.Discard, reader.reader, int64(n))
 	if err != nil && err != io.EOF {
-		return fmt.Errorf("error skiSpping %d bytes: %w", n, err)
+		return fmt.Errorf("error skipping %d bytes: %w", n, err)
 	}
 	return nil
 }
+
+// Body returns the unread rest of the current message and consumes it. The
+// slice is only valid until the next ReadMessage.
+func (r *PgReader) Body() []byte {
+	if !r.inMessage {
+		return nil
+	}
+	body := r.buf[r.pos:]
+	r.pos = len(r.buf)
+	return body
+}
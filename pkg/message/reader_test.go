@@ -0,0 +1,56 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func frame(msgType byte, length int32, body []byte) []byte {
+	data := appendInt32([]byte{msgType}, length)
+	return append(data, body...)
+}
+
+func TestReadMessageLargeBody(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 100_000)
+	data := frame('D', int32(len(body)+4), body)
+	data = append(data, frame('Z', 5, []byte{'I'})...)
+
+	r := NewPgReader(bytes.NewReader(data))
+	msgType, _, err := r.ReadMessage()
+	if err != nil || msgType != 'D' {
+		t.Fatalf("ReadMessage = %q, %v", msgType, err)
+	}
+	if !bytes.Equal(r.Body(), body) {
+		t.Fatal("body differs from the one sent")
+	}
+	if msgType, _, err = r.ReadMessage(); err != nil || msgType != 'Z' || !bytes.Equal(r.Body(), []byte{'I'}) {
+		t.Fatalf("ReadMessage after a large body = %q, %v", msgType, err)
+	}
+}
+
+func TestReadMessageTruncatedBody(t *testing.T) {
+	// Claims 60MB but ends after a few bytes
+	r := NewPgReader(bytes.NewReader(frame('D', 60<<20, []byte("abc"))))
+	_, _, err := r.ReadMessage()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if cap(r.buf) > 2*messageReadChunk {
+		t.Fatalf("allocated %d bytes for 3 bytes of data", cap(r.buf))
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	r := NewPgReader(bytes.NewReader(frame('D', DefaultMaxMessageSize+5, nil)))
+	if _, _, err := r.ReadMessage(); err == nil {
+		t.Fatal("expected an error for a message over the maximum size")
+	}
+
+	r = NewPgReader(bytes.NewReader(frame('D', 4+100, make([]byte, 100))))
+	r.SetMaxMessageSize(99)
+	if _, _, err := r.ReadMessage(); err == nil {
+		t.Fatal("expected an error for a message over the configured size")
+	}
+}
@@ -0,0 +1,140 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// ReplayServer is a fake server for regression tests that plays back a
+// recorded conversation. Every connection it accepts starts the recording
+// from the top: frontend records are matched against what the client sends
+// and backend records are written back in between.
+type ReplayServer struct {
+	// Strict also compares message bodies, not only message types. Bodies
+	// often differ between runs, e.g. in generated statement names.
+	Strict bool
+
+	listener net.Listener
+	records  []WireRecord
+	mu       sync.Mutex
+	err      error
+}
+
+// NewReplayServer starts a server on a random local port
+func NewReplayServer(records []WireRecord) (*ReplayServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error starting replay server: %w", err)
+	}
+
+	server := &ReplayServer{listener: listener, records: records}
+	go server.serve()
+	return server, nil
+}
+
+// Addr returns the host and port the server listens on
+func (server *ReplayServer) Addr() (string, string) {
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	return host, port
+}
+
+// Err returns the first difference between a client and the recording
+func (server *ReplayServer) Err() error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.err
+}
+
+func (server *ReplayServer) Close() error {
+	return server.listener.Close()
+}
+
+func (server *ReplayServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := server.replay(conn); err != nil {
+				server.fail(err)
+			}
+		}()
+	}
+}
+
+func (server *ReplayServer) fail(err error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.err == nil {
+		server.err = err
+	}
+}
+
+func (server *ReplayServer) replay(conn net.Conn) error {
+	var pending bytes.Buffer
+	for i, record := range server.records {
+		if record.Direction == Backend {
+			// Consecutive backend messages go out together, as a server sends them
+			pending.Write(record.Frame())
+			continue
+		}
+
+		if pending.Len() > 0 {
+			if _, err := conn.Write(pending.Bytes()); err != nil {
+				return fmt.Errorf("error replaying record %d: %w", i, err)
+			}
+			pending.Reset()
+		}
+
+		msgType, data, err := readFrontendMessage(conn, record.Type == "")
+		if err != nil {
+			return fmt.Errorf("expected %s (record %d): %w", record.Name, i+1, err)
+		}
+		if msgType != record.Type {
+			return fmt.Errorf("expected %s (record %d), client sent %s", record.Name, i+1, MessageType(msgType[0]).FrontendString())
+		}
+		if server.Strict && !bytes.Equal(data, record.Data) {
+			return fmt.Errorf("client sent a different %s than recorded (record %d): %q", record.Name, i+1, data)
+		}
+	}
+
+	if pending.Len() > 0 {
+		if _, err := conn.Write(pending.Bytes()); err != nil {
+			return fmt.Errorf("error replaying final records: %w", err)
+		}
+	}
+	// Wait for the client to hang up so the last replies are not cut off
+	io.Copy(io.Discard, conn)
+	return nil
+}
+
+func readFrontendMessage(reader io.Reader, untyped bool) (string, []byte, error) {
+	msgType := ""
+	if !untyped {
+		var typeByte [1]byte
+		if _, err := io.ReadFull(reader, typeByte[:]); err != nil {
+			return "", nil, err
+		}
+		msgType = string(typeByte[:])
+	}
+
+	var lengthBytes [4]byte
+	if _, err := io.ReadFull(reader, lengthBytes[:]); err != nil {
+		return "", nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(lengthBytes[:]))
+	if length < 4 {
+		return "", nil, fmt.Errorf("invalid message length %d", length)
+	}
+	data := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", nil, err
+	}
+	return msgType, data, nil
+}
@@ -0,0 +1,137 @@
+package message_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mparavac97/PgClient/pkg/client"
+	"github.com/mparavac97/PgClient/pkg/message"
+)
+
+// record builds the wire record of msg as a WireTrace would write it
+func record(direction string, msg message.Message) message.WireRecord {
+	frame := msg.Encode(nil)
+	if _, ok := msg.(*message.StartupMessage); ok {
+		return message.WireRecord{Direction: direction, Name: "StartupMessage", Data: frame[4:]}
+	}
+	return message.WireRecord{Direction: direction, Type: string(frame[:1]), Data: frame[5:]}
+}
+
+// conversation is a connection that runs one query returning two rows and
+// one query that fails
+func conversation() []message.WireRecord {
+	return []message.WireRecord{
+		record(message.Frontend, &message.StartupMessage{ProtocolVersion: message.ProtocolVersion30}),
+		record(message.Backend, &message.AuthenticationOk{}),
+		record(message.Backend, &message.ParameterStatusMessage{Name: "server_version", Value: "17.0"}),
+		record(message.Backend, &message.BackendKeyDataMessage{ProcessID: 42, SecretKey: []byte{0, 0, 0, 7}}),
+		record(message.Backend, &message.ReadyForQueryMessage{TxStatus: 'I'}),
+		record(message.Frontend, &message.QueryMessage{SQL: "select id, name from users"}),
+		record(message.Backend, &message.RowDescriptionMessage{Fields: []message.FieldDescription{
+			{Name: "id", DataTypeOID: 23, DataTypeSize: 4, TypeModifier: -1},
+			{Name: "name", DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1},
+		}}),
+		record(message.Backend, &message.DataRowMessage{Values: [][]byte{[]byte("1"), []byte("alice")}}),
+		record(message.Backend, &message.DataRowMessage{Values: [][]byte{[]byte("2"), nil}}),
+		record(message.Backend, &message.CommandCompleteMessage{Tag: "SELECT 2"}),
+		record(message.Backend, &message.ReadyForQueryMessage{TxStatus: 'I'}),
+		record(message.Frontend, &message.QueryMessage{SQL: "select missing from users"}),
+		record(message.Backend, &message.ErrorFieldsMessage{Type: message.ErrorResponse, Fields: map[byte]string{
+			'S': "ERROR", 'C': "42703", 'M': `column "missing" does not exist`,
+		}}),
+		record(message.Backend, &message.ReadyForQueryMessage{TxStatus: 'I'}),
+	}
+}
+
+type queryOutcome struct {
+	rows []map[string]any
+	err  string
+}
+
+// runQueries connects to server and runs the queries of the conversation
+func runQueries(t *testing.T, server *message.ReplayServer, trace *message.WireTrace) []queryOutcome {
+	t.Helper()
+	host, port := server.Addr()
+	conn := client.NewPgConnection("host=" + host + ";port=" + port + ";username=app;database=app")
+	conn.SetWireTrace(trace)
+	if err := conn.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+
+	var outcomes []queryOutcome
+	for _, sql := range []string{"select id, name from users", "select missing from users"} {
+		result, err := client.NewPgCommand(sql, conn).Execute()
+		outcome := queryOutcome{rows: result.Rows}
+		if err != nil {
+			outcome.err = err.Error()
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes
+}
+
+func TestReplayRecordedTrace(t *testing.T) {
+	source, err := message.NewReplayServer(conversation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	var records bytes.Buffer
+	recorded := runQueries(t, source, message.NewWireTrace(nil, &records))
+	if err := source.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	if len(recorded[0].rows) != 2 || recorded[1].err == "" {
+		t.Fatalf("unexpected results while recording: %+v", recorded)
+	}
+
+	trace, err := message.ReadWireRecords(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) != len(conversation()) {
+		t.Fatalf("traced %d records, want %d", len(trace), len(conversation()))
+	}
+
+	replay, err := message.NewReplayServer(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	replay.Strict = true
+
+	replayed := runQueries(t, replay, nil)
+	if err := replay.Err(); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Fatalf("replayed results differ:\n got %+v\nwant %+v", replayed, recorded)
+	}
+}
+
+func TestReplayDetectsDifferentClient(t *testing.T) {
+	records := conversation()
+	server, err := message.NewReplayServer(records[:6])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	host, port := server.Addr()
+	conn := client.NewPgConnection("host=" + host + ";port=" + port + ";username=app;database=app")
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	cmd := client.NewPgCommand("select :id", conn)
+	cmd.SetParameter("id", 1)
+	// The recording expects a simple query, so the server hangs up on Parse
+	cmd.Execute()
+	conn.Close()
+
+	if server.Err() == nil {
+		t.Fatal("expected the replay to report a mismatch")
+	}
+}
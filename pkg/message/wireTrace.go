@@ -0,0 +1,310 @@
+package message
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directions of a traced message
+const (
+	Frontend = "F" // sent by the client
+	Backend  = "B" // sent by the server
+)
+
+// Codes of the untyped messages a client may open a connection with
+const (
+	sslRequestCode    = 80877103
+	gssRequestCode    = 80877104
+	cancelRequestCode = 80877102
+)
+
+// WireRecord is one traced message. Type is empty for the untyped startup
+// messages. Data is the message body without type byte and length.
+type WireRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type,omitempty"`
+	Name      string    `json:"name"`
+	Data      []byte    `json:"data"`
+}
+
+// WireTrace records every message exchanged on a connection, as readable
+// lines in the spirit of libpq's PQtrace and as JSON lines that
+// ReadWireRecords and the ReplayServer understand. Either output may be nil.
+//
+// Password messages and Bind parameter values are redacted unless
+// ShowSecrets is set. The JSON records keep Bind parameters, which a strict
+// replay compares, but never the password unless ShowSecrets is set.
+type WireTrace struct {
+	// ShowSecrets traces passwords and parameter values as sent
+	ShowSecrets bool
+
+	mu      sync.Mutex
+	text    io.Writer
+	records *json.Encoder
+}
+
+func NewWireTrace(text io.Writer, records io.Writer) *WireTrace {
+	trace := &WireTrace{text: text}
+	if records != nil {
+		trace.records = json.NewEncoder(records)
+	}
+	return trace
+}
+
+// Reader returns a reader that traces the backend messages read through it
+func (trace *WireTrace) Reader(reader io.Reader) io.Reader {
+	return &tracingReader{reader: reader, frames: &frameSplitter{trace: trace, direction: Backend}}
+}
+
+// Writer returns a writer that traces the frontend messages written through
+// it. The first message is taken to be the untyped startup message.
+func (trace *WireTrace) Writer(writer io.Writer) io.Writer {
+	return &tracingWriter{writer: writer, frames: &frameSplitter{trace: trace, direction: Frontend, untyped: true}}
+}
+
+func (trace *WireTrace) record(record WireRecord) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	if trace.text != nil {
+		fmt.Fprintf(trace.text, "%s\t%s\t%d\t%s\t%s\n",
+			record.Time.Format("2006-01-02 15:04:05.000000"), record.Direction, len(record.Data)+4, record.Name, trace.describe(record))
+	}
+	if trace.records != nil {
+		if isPasswordRecord(record) && !trace.ShowSecrets {
+			record.Data = nil
+		}
+		trace.records.Encode(record)
+	}
+}
+
+const redacted = "[REDACTED]"
+
+func isPasswordRecord(record WireRecord) bool {
+	return record.Direction == Frontend && record.Type == string(rune(Password))
+}
+
+// describe prints the fields of the traced message, or its raw body if it
+// does not decode
+func (trace *WireTrace) describe(record WireRecord) string {
+	if isPasswordRecord(record) && !trace.ShowSecrets {
+		return redacted
+	}
+
+	msg, err := decodeRecord(record)
+	if err != nil {
+		if record.Direction == Frontend && record.Type == string(rune(Bind)) && !trace.ShowSecrets {
+			return redacted
+		}
+		return fmt.Sprintf("%q", record.Data)
+	}
+	if bind, ok := msg.(*BindMessage); ok && !trace.ShowSecrets {
+		fields := formatFields(reflect.ValueOf(bind).Elem(), "Parameters")
+		return fields + fmt.Sprintf(" Parameters=%s", redacted)
+	}
+	return formatFields(reflect.ValueOf(msg).Elem())
+}
+
+func decodeRecord(record WireRecord) (Message, error) {
+	if record.Type != "" {
+		if record.Direction == Frontend {
+			return DecodeFrontend(record.Type[0], record.Data)
+		}
+		return DecodeBackend(record.Type[0], record.Data)
+	}
+
+	var msg Message
+	switch record.Name {
+	case "SSLRequest":
+		msg = &SSLRequest{}
+	case "GSSENCRequest":
+		msg = &GSSENCRequest{}
+	case "CancelRequest":
+		msg = &CancelRequest{}
+	default:
+		msg = &StartupMessage{}
+	}
+	return msg, msg.Decode(record.Data)
+}
+
+// formatFields prints the fields of a message struct as Name=value pairs
+func formatFields(msg reflect.Value, skip ...string) string {
+	fields := make([]string, 0, msg.NumField())
+	for i := 0; i < msg.NumField(); i++ {
+		name := msg.Type().Field(i).Name
+		if contains(skip, name) {
+			continue
+		}
+		fields = append(fields, name+"="+formatValue(msg.Field(i)))
+	}
+	return strings.Join(fields, " ")
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func formatValue(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", value.String())
+	case reflect.Uint8:
+		return fmt.Sprintf("%q", rune(value.Uint()))
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			if value.IsNil() {
+				return "NULL"
+			}
+			return fmt.Sprintf("%q", value.Bytes())
+		}
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = formatValue(value.Index(i))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case reflect.Map:
+		items := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			items = append(items, formatValue(key)+":"+formatValue(value.MapIndex(key)))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, " ") + "}"
+	case reflect.Struct:
+		return "{" + formatFields(value) + "}"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+type tracingReader struct {
+	reader io.Reader
+	frames *frameSplitter
+}
+
+func (r *tracingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.frames.write(p[:n])
+	return n, err
+}
+
+type tracingWriter struct {
+	writer io.Writer
+	frames *frameSplitter
+}
+
+func (w *tracingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.frames.write(p[:n])
+	return n, err
+}
+
+// frameSplitter cuts a byte stream into messages, however the reads or
+// writes happen to split it
+type frameSplitter struct {
+	trace     *WireTrace
+	direction string
+	untyped   bool // the next message has no type byte
+	pending   []byte
+}
+
+func (f *frameSplitter) write(p []byte) {
+	f.pending = append(f.pending, p...)
+	for {
+		header := 5
+		if f.untyped {
+			header = 4
+		}
+		if len(f.pending) < header {
+			return
+		}
+		length := int(binary.BigEndian.Uint32(f.pending[header-4 : header]))
+		if length < 4 {
+			// Not a message stream we understand, stop tracing it
+			f.pending = nil
+			return
+		}
+		end := header - 4 + length
+		if len(f.pending) < end {
+			return
+		}
+
+		record := WireRecord{
+			Time:      time.Now(),
+			Direction: f.direction,
+			Data:      append([]byte(nil), f.pending[header:end]...),
+		}
+		if f.untyped {
+			record.Name = untypedMessageName(record.Data)
+			// Only an SSL or GSS request is followed by another untyped message
+			f.untyped = record.Name == "SSLRequest" || record.Name == "GSSENCRequest"
+		} else {
+			record.Type = string(f.pending[0])
+			if f.direction == Frontend {
+				record.Name = MessageType(f.pending[0]).FrontendString()
+			} else {
+				record.Name = MessageType(f.pending[0]).String()
+			}
+		}
+		f.trace.record(record)
+		f.pending = f.pending[end:]
+	}
+}
+
+func untypedMessageName(data []byte) string {
+	if len(data) < 4 {
+		return "StartupMessage"
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case sslRequestCode:
+		return "SSLRequest"
+	case gssRequestCode:
+		return "GSSENCRequest"
+	case cancelRequestCode:
+		return "CancelRequest"
+	default:
+		return "StartupMessage"
+	}
+}
+
+// ReadWireRecords reads the JSON lines written by a WireTrace
+func ReadWireRecords(reader io.Reader) ([]WireRecord, error) {
+	records := make([]WireRecord, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record WireRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("error reading wire record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading wire records: %w", err)
+	}
+	return records, nil
+}
+
+// Frame returns the record as it appeared on the wire
+func (record WireRecord) Frame() []byte {
+	frame := make([]byte, 0, len(record.Data)+5)
+	frame = append(frame, record.Type...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(record.Data)+4))
+	return append(frame, record.Data...)
+}
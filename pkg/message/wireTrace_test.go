@@ -0,0 +1,75 @@
+package message
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// traceFrontend traces the messages as sent by a client after startup
+func traceFrontend(trace *WireTrace, msgs ...Message) {
+	writer := trace.Writer(io.Discard)
+	writer.Write((&StartupMessage{ProtocolVersion: ProtocolVersion30, Parameters: map[string]string{"user": "app"}}).Encode(nil))
+	for _, msg := range msgs {
+		writer.Write(msg.Encode(nil))
+	}
+}
+
+func TestWireTraceText(t *testing.T) {
+	var text bytes.Buffer
+	trace := NewWireTrace(&text, nil)
+	traceFrontend(trace, &QueryMessage{SQL: "select 1"})
+	var backend []byte
+	backend = (&DataRowMessage{Values: [][]byte{[]byte("1"), nil}}).Encode(backend)
+	backend = (&ReadyForQueryMessage{TxStatus: 'I'}).Encode(backend)
+	io.Copy(io.Discard, trace.Reader(bytes.NewReader(backend)))
+
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	want := []string{
+		"F\t18\tStartupMessage\tProtocolVersion=196608 Parameters={\"user\":\"app\"}",
+		"F\t13\tQuery\tSQL=\"select 1\"",
+		"B\t15\tDataRow\tValues=[\"1\" NULL]",
+		"B\t5\tReadyForQuery\tTxStatus='I'",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("traced %d lines, want %d:\n%s", len(lines), len(want), text.String())
+	}
+	for i, line := range lines {
+		// Skip the timestamp
+		if got := line[strings.Index(line, "\t")+1:]; got != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestWireTraceRedactsSecrets(t *testing.T) {
+	secrets := []Message{
+		&PasswordMessage{Password: "hunter2"},
+		&BindMessage{Statement: "s1", Parameters: [][]byte{[]byte("hunter2")}},
+	}
+
+	var text, records bytes.Buffer
+	traceFrontend(NewWireTrace(&text, &records), secrets...)
+	if strings.Contains(text.String(), "hunter2") || strings.Contains(text.String(), "aHVudGVyMg") {
+		t.Fatalf("trace shows a secret:\n%s", text.String())
+	}
+	if !strings.Contains(text.String(), `Statement="s1"`) {
+		t.Fatalf("trace hides the Bind statement:\n%s", text.String())
+	}
+	traced, err := ReadWireRecords(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traced[1].Data != nil {
+		t.Fatalf("records keep the password: %q", traced[1].Data)
+	}
+
+	text.Reset()
+	trace := NewWireTrace(&text, nil)
+	trace.ShowSecrets = true
+	traceFrontend(trace, secrets...)
+	if strings.Count(text.String(), "hunter2") != 2 {
+		t.Fatalf("trace hides secrets despite ShowSecrets:\n%s", text.String())
+	}
+}